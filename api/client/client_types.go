@@ -15,49 +15,210 @@ type SimplifiedClientInfo struct {
 	IsIPv4 bool   `json:"is_ipv4"`
 	Org    string `json:"org"`
 	Mss    *int   `json:"mss"`
+	// detected by the api from the MSS, e.g. PPPoE, IPoE, DS-Lite, MAP-E
+	ConnectionType *SimplifiedConnectionType `json:"connection_type,omitempty"`
+	// guessed locally from the MTU, independent of the api
+	LocalConnectionType *AccessTypeGuess `json:"local_connection_type,omitempty"`
+}
+
+// AccessTypeGuess is the access type guessed locally from the MTU
+type AccessTypeGuess struct {
+	Name       string                `json:"name"`
+	Confidence float64               `json:"confidence"` // 0-1
+	Mtu        int                   `json:"mtu"`
+	Ambiguous  bool                  `json:"ambiguous,omitempty"` // the best candidates have the same confidence, Name joins them
+	Candidates []AccessTypeCandidate `json:"candidates,omitempty"`
+}
+
+type AccessTypeCandidate struct {
+	Name       string  `json:"name"`
+	Confidence float64 `json:"confidence"`
+}
+
+type AccessTypeGuessPair struct {
+	IPv4 *AccessTypeGuess `json:"ipv4"`
+	IPv6 *AccessTypeGuess `json:"ipv6"`
+}
+
+type SimplifiedConnectionType struct {
+	Name string `json:"name"`
+	Mss  int    `json:"mss"`
 }
 
 type SimplifiedSpeedtestResult struct {
-	SpeedtestType string  `json:"speedtest_type"`
-	UnixTime      int64   `json:"timestamp"`
-	Server        string  `json:"server"`
-	Upload        float64 `json:"upload"`
-	Download      float64 `json:"download"`
-	Ping          float64 `json:"ping"`
-	Jitter        float64 `json:"jitter"`
+	SpeedtestType string       `json:"speedtest_type"`
+	UnixTime      int64        `json:"timestamp"`
+	Server        string       `json:"server"`
+	Upload        *float64     `json:"upload,omitempty"`   // absent when skipped
+	Download      *float64     `json:"download,omitempty"` // absent when skipped
+	Ping          float64      `json:"ping"`
+	Jitter        float64      `json:"jitter"`
+	Bufferbloat   *Bufferbloat `json:"bufferbloat,omitempty"`
+	// only with --samples
+	DownloadDetail *PhaseDetail `json:"download_detail,omitempty"`
+	UploadDetail   *PhaseDetail `json:"upload_detail,omitempty"`
 }
 
+// SimplifiedResultSchemaVersion is bumped on every incompatible change of SimplifiedResult (see: schema subcommand)
+const SimplifiedResultSchemaVersion = 1
+
 type SimplifiedResult struct {
+	SchemaVersion   int                         `json:"schema_version"`
 	Timestamp       int64                       `json:"timestamp"`
 	IPv4Available   bool                        `json:"ipv4_available"`
 	IPv6Available   bool                        `json:"ipv6_available"`
 	IPv4Info        *SimplifiedClientInfo       `json:"ipv4_info,omitempty"`
 	IPv6Info        *SimplifiedClientInfo       `json:"ipv6_info,omitempty"`
-	SpeedtestResult []SimplifiedSpeedtestResult `json:"result"` //測定先が増えた際に連携先が壊れないように
+	Flets           *v3.FletsRegion             `json:"flets,omitempty"` // east, west or both
+	SpeedtestResult []SimplifiedSpeedtestResult `json:"result"`          //測定先が増えた際に連携先が壊れないように
+	MSS             []*MSSResult                `json:"mss,omitempty"`
+	QUIC            []*QUICResult               `json:"quic,omitempty"`
+	Parameters      *SpeedtestParameters        `json:"parameters,omitempty"`
 }
 
 type ClientInfoPair struct {
-	IPv4Info v3.ClientInfo
-	IPv6Info v3.ClientInfo
+	IPv4Info v3.ClientInfo `json:"ipv4"`
+	IPv6Info v3.ClientInfo `json:"ipv6"`
+}
+
+// ThroughputSample is the throughput of one sample interval, in the unit of the result
+type ThroughputSample struct {
+	Time    float64   `json:"t"`       // seconds since the start of the phase
+	Rate    float64   `json:"rate"`    // all streams
+	Streams []float64 `json:"streams"` // per stream
+}
+
+// ThroughputStats summarises the samples of a phase
+type ThroughputStats struct {
+	Peak      float64 `json:"peak"`
+	Median    float64 `json:"median"`
+	P10       float64 `json:"p10"`
+	P90       float64 `json:"p90"`
+	Stability float64 `json:"stability"` // 0-1, 1 - coefficient of variation of the samples
+}
+
+// PhaseDetail is the per-direction detail measured by the native engine
+type PhaseDetail struct {
+	Elapsed     float64            `json:"elapsed"`      // seconds
+	Warmup      float64            `json:"warmup"`       // seconds excluded from the rate and the stats
+	WarmupBytes uint64             `json:"warmup_bytes"` // bytes transferred during the warm-up, still counted in bytes_sent/bytes_received
+	StreamBytes []uint64           `json:"stream_bytes"` // bytes per concurrent stream
+	Adaptive    bool               `json:"adaptive"`
+	Converged   bool               `json:"converged"`        // adaptive mode stopped before the max duration
+	Errors      int                `json:"errors,omitempty"` // failed requests of the streams, retried until the end of the phase
+	Stats       *ThroughputStats   `json:"stats,omitempty"`
+	Samples     []ThroughputSample `json:"samples,omitempty"`
+}
+
+// LoadedLatency is the RTT measured while the link is saturated in one direction
+type LoadedLatency struct {
+	RTT    float64 `json:"rtt"`   // ms, median of the probes
+	Delta  float64 `json:"delta"` // ms, increase over the idle RTT
+	Grade  string  `json:"grade"`
+	Probes int     `json:"probes"`         // timed out probes count as the probe timeout
+	Lost   int     `json:"lost,omitempty"` // probes timed out or failed under load
+}
+
+// Bufferbloat compares the idle RTT to the RTT under load
+type Bufferbloat struct {
+	IdleRTT  float64        `json:"idle_rtt"` // ms
+	Download *LoadedLatency `json:"download,omitempty"`
+	Upload   *LoadedLatency `json:"upload,omitempty"`
+	Grade    string         `json:"grade"` // worst of download and upload
+}
+
+// MSSServerResult is the MSS seen by one MSS endpoint
+type MSSServerResult struct {
+	Endpoint     string           `json:"endpoint"`
+	Mss          int              `json:"mss"`
+	ActualMss    int              `json:"actual_mss"` // exclude TCP option(timestamp)
+	EstimatedMtu int              `json:"estimated_mtu"`
+	Guess        *AccessTypeGuess `json:"guess,omitempty"`
+	Error        string           `json:"error,omitempty"`
+}
+
+// MSSResult compares the MSS seen by the api and by every MSS oneshot server on one family
+type MSSResult struct {
+	Family   string             `json:"family"`
+	Servers  []*MSSServerResult `json:"servers"`
+	Disagree bool               `json:"disagree"` // the MSS differs by destination, e.g. a tunnel on some paths only
+}
+
+// QUICResult is the QUIC/HTTP/3 oneshot probe of one family, compared to the same endpoint over TCP
+type QUICResult struct {
+	Endpoint      string  `json:"endpoint"`
+	Family        string  `json:"family"`
+	Status        string  `json:"status"` // ok, blocked (no handshake) or error
+	Error         string  `json:"error,omitempty"`
+	Handshake     float64 `json:"handshake"` // ms
+	Protocol      string  `json:"protocol"`  // negotiated ALPN
+	HTTP3         bool    `json:"http3"`
+	Throughput    float64 `json:"throughput"`               // unit of the result
+	TCPThroughput float64 `json:"tcp_throughput,omitempty"` // same endpoint and duration over TCP
+	Throttled     bool    `json:"throttled"`                // QUIC far below TCP
 }
 
 type SpeedtestResult struct {
 	report.JSONReport
-	ID *string
+	ID              *string      `json:"id"` // telemetry ID reported to the session
+	DownloadSkipped bool         `json:"download_skipped"`
+	UploadSkipped   bool         `json:"upload_skipped"`
+	Engine          string       `json:"engine"`
+	DownloadDetail  *PhaseDetail `json:"download_detail,omitempty"`
+	UploadDetail    *PhaseDetail `json:"upload_detail,omitempty"`
+	Bufferbloat     *Bufferbloat `json:"bufferbloat,omitempty"`
 }
 
 type SpeedtestResultPair struct {
-	IPv4Result *SpeedtestResult
-	IPv6Result *SpeedtestResult
+	IPv4Result  *SpeedtestResult   `json:"-"`
+	IPv6Result  *SpeedtestResult   `json:"-"`
+	IPv4Results []*SpeedtestResult `json:"ipv4"` // every pinned server, IPv4Result is the first one
+	IPv6Results []*SpeedtestResult `json:"ipv6"`
+}
+
+// SpeedtestParameters are the measurement settings of a run, echoed into the output
+type SpeedtestParameters struct {
+	Concurrent     int     `json:"concurrent"`
+	Duration       int     `json:"duration"` // seconds per direction
+	Warmup         float64 `json:"warmup"`   // seconds at the start of each direction excluded from the rate
+	Adaptive       bool    `json:"adaptive"` // duration is the cap, stop once the rate is stable
+	MinDuration    float64 `json:"min_duration,omitempty"`
+	Tolerance      float64 `json:"tolerance,omitempty"`
+	Chunks         int     `json:"chunks"`
+	UploadSize     int     `json:"upload_size"` // KiB
+	Timeout        int     `json:"timeout"`     // seconds
+	NoPreAllocate  bool    `json:"no_pre_allocate"`
+	NoDownload     bool    `json:"no_download"`
+	NoUpload       bool    `json:"no_upload"`
+	Engine         string  `json:"engine"`
+	Bufferbloat    bool    `json:"bufferbloat"`
+	QUIC           bool    `json:"quic"`
+	Samples        bool    `json:"samples"`
+	SampleInterval float64 `json:"sample_interval"` // seconds
+	Unit           string  `json:"unit"`            // unit of upload and download
 }
 
 type Result struct {
-	IPv4Available       bool
-	IPv6Available       bool
-	ClientInfoPair      ClientInfoPair
-	AccessTypeSession   v3.AccessTypeSession
-	SpeedtestResultPair SpeedtestResultPair
-	Session             v3.SpeedtestSession
+	Parameters          SpeedtestParameters  `json:"parameters"`
+	IPv4Available       bool                 `json:"ipv4_available"`
+	IPv6Available       bool                 `json:"ipv6_available"`
+	ClientInfoPair      ClientInfoPair       `json:"client_info"`
+	AccessTypeSession   v3.AccessTypeSession `json:"access_type_session"`
+	AccessTypeGuess     AccessTypeGuessPair  `json:"access_type_guess"`
+	SpeedtestResultPair SpeedtestResultPair  `json:"speedtest"`
+	MSSResults          []*MSSResult         `json:"mss"`
+	QUICResults         []*QUICResult        `json:"quic"`
+	Session             v3.SpeedtestSession  `json:"session"`
+}
+
+// FullResultSchemaVersion is bumped on every incompatible change of the --output json:full schema
+const FullResultSchemaVersion = 1
+
+// FullResult is the --output json:full schema, the complete Result with its schema version
+type FullResult struct {
+	SchemaVersion int    `json:"schema_version"`
+	ClientVersion string `json:"client_version"`
+	*Result
 }
 
 type Config struct {
@@ -81,6 +242,8 @@ type Config struct {
 	Distance       string        `json:"distance,omitempty"`
 	List           bool          `json:"list,omitempty"`
 	Server         []int         `json:"server,omitempty"`
+	ExcludeServer  []int         `json:"exclude-server,omitempty"`
+	ServerName     []string      `json:"server-name,omitempty"`
 	Source         string        `json:"source,omitempty"`
 	Interface      string        `json:"interface,omitempty"`
 	Timeout        int           `json:"timeout,omitempty"`
@@ -90,6 +253,18 @@ type Config struct {
 	Secure         bool          `json:"secure,omitempty"`
 	CACert         string        `json:"ca-cert,omitempty"`
 	NoPreAllocate  bool          `json:"no-pre-allocate,omitempty"`
+	NoDownload     bool          `json:"no-download,omitempty"`
+	NoUpload       bool          `json:"no-upload,omitempty"`
+	Engine         string        `json:"engine,omitempty"`
+	Samples        bool          `json:"samples,omitempty"`
+	SampleInterval time.Duration `json:"sample-interval,omitempty"`
+	NoBufferbloat  bool          `json:"no-bufferbloat,omitempty"`
+	Warmup         time.Duration `json:"warmup,omitempty"`
+	Adaptive       bool          `json:"adaptive,omitempty"`
+	MinDuration    time.Duration `json:"min-duration,omitempty"`
+	Tolerance      float64       `json:"tolerance,omitempty"`
+	NoQUIC         bool          `json:"no-quic,omitempty"`
+	QUICDuration   time.Duration `json:"quic-duration,omitempty"`
 }
 
 type Client struct {
@@ -0,0 +1,147 @@
+// Package accesstype guesses the access technology from the MSS/MTU seen by a server,
+// without relying on the api side classification.
+package accesstype
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	clientTypes "github.com/inonius/v3cli/api/client"
+	v3 "github.com/inonius/v3cli/api/v3"
+)
+
+const (
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+
+	Unknown = "Unknown"
+
+	// MTUs up to this far from a rule still match it, with a lower confidence.
+	// Less than the 6 bytes between the PPPoE of FLET'S and IPv4 over IPv6.
+	nearMatch = 4
+
+	// the TCP timestamp option excluded from ActualMss
+	timestampOption = 12
+)
+
+// Rule maps the path MTU of a family to an access technology
+type Rule struct {
+	Name       string  `mapstructure:"name" json:"name"`
+	Family     string  `mapstructure:"family" json:"family"` // ipv4, ipv6, or empty for both
+	Mtu        int     `mapstructure:"mtu" json:"mtu"`
+	Confidence float64 `mapstructure:"confidence" json:"confidence"` // 0-1 when this rule is the match
+}
+
+// DefaultRules are the usual MTUs of the access technologies found in Japan, named like the connection types of the api.
+// The MTU is the MSS the api reports for the connection type plus the headers, 40 bytes on IPv4 and 60 on IPv6.
+func DefaultRules() []Rule {
+	return []Rule{
+		// MSS 1460 on IPv4, 1440 on IPv6
+		{Name: "IPoE", Mtu: 1500, Confidence: 0.8},
+		// MSS 1414 on IPv4, 1394 on IPv6, the PPPoE of FLET'S
+		{Name: "PPPoE", Mtu: 1454, Confidence: 0.9},
+		// MSS 1452 on IPv4, 1432 on IPv6
+		{Name: "PPPoE", Mtu: 1492, Confidence: 0.85},
+		// IPv4 over IPv6, the 40 bytes IPv6 header (MSS 1420), the MTU cannot tell them apart so the guess is ambiguous
+		{Name: "DS-Lite", Family: FamilyIPv4, Mtu: 1460, Confidence: 0.45},
+		{Name: "MAP-E", Family: FamilyIPv4, Mtu: 1460, Confidence: 0.45},
+		// IPv4 translated to IPv6 by the CLAT, or an IPv4 over IPv4 tunnel
+		{Name: "464XLAT", Family: FamilyIPv4, Mtu: 1480, Confidence: 0.5},
+		{Name: "IPIP", Family: FamilyIPv4, Mtu: 1480, Confidence: 0.3},
+		{Name: "GRE", Mtu: 1476, Confidence: 0.6},
+		{Name: "6in4", Family: FamilyIPv6, Mtu: 1480, Confidence: 0.7},
+		{Name: "WireGuard", Mtu: 1420, Confidence: 0.5},
+		{Name: "MinimumIPv6", Family: FamilyIPv6, Mtu: 1280, Confidence: 0.4},
+	}
+}
+
+// Classifier matches MSS responses against a rule table
+type Classifier struct {
+	rules []Rule
+}
+
+// NewClassifier uses the default rules, extra rules replace a default rule of the same name, family and MTU
+func NewClassifier(extra []Rule) *Classifier {
+	var rules []Rule
+	for _, r := range DefaultRules() {
+		overridden := false
+		for _, e := range extra {
+			if strings.EqualFold(e.Name, r.Name) && strings.EqualFold(e.Family, r.Family) && e.Mtu == r.Mtu {
+				overridden = true
+			}
+		}
+		if !overridden {
+			rules = append(rules, r)
+		}
+	}
+	return &Classifier{rules: append(rules, extra...)}
+}
+
+// Rules returns the effective rule table
+func (c *Classifier) Rules() []Rule {
+	return c.rules
+}
+
+// Classify guesses the access type of a family. The MTU is the one estimated by the server when present,
+// else derived from ActualMss, else from the MSS.
+// When the best candidates have the same confidence, the guess is ambiguous and named after all of them.
+func (c *Classifier) Classify(isIPv4 bool, mr v3.MSSResponse) *clientTypes.AccessTypeGuess {
+	family, header := FamilyIPv6, 60
+	if isIPv4 {
+		family, header = FamilyIPv4, 40
+	}
+	mtu := mtuOf(mr, header)
+	guess := &clientTypes.AccessTypeGuess{Name: Unknown, Mtu: mtu}
+	if mtu == 0 {
+		return guess
+	}
+
+	for _, r := range c.rules {
+		if r.Family != "" && !strings.EqualFold(r.Family, family) {
+			continue
+		}
+		diff := math.Abs(float64(mtu - r.Mtu))
+		if diff > nearMatch {
+			continue
+		}
+		guess.Candidates = append(guess.Candidates, clientTypes.AccessTypeCandidate{
+			Name:       r.Name,
+			Confidence: round(r.Confidence * (1 - diff/(2*nearMatch))),
+		})
+	}
+	if len(guess.Candidates) == 0 {
+		return guess
+	}
+
+	sort.SliceStable(guess.Candidates, func(i, j int) bool {
+		return guess.Candidates[i].Confidence > guess.Candidates[j].Confidence
+	})
+	guess.Name = guess.Candidates[0].Name
+	guess.Confidence = guess.Candidates[0].Confidence
+	for _, candidate := range guess.Candidates[1:] {
+		if candidate.Confidence != guess.Confidence {
+			break
+		}
+		guess.Name += "/" + candidate.Name
+		guess.Ambiguous = true
+	}
+	return guess
+}
+
+// mtuOf derives the path MTU from the MSS response, 0 when unknown
+func mtuOf(mr v3.MSSResponse, header int) int {
+	switch {
+	case mr.EstinamtedMtu > 0:
+		return mr.EstinamtedMtu
+	case mr.ActualMss > 0:
+		return mr.ActualMss + header + timestampOption
+	case mr.Mss > 0:
+		return mr.Mss + header
+	}
+	return 0
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,132 @@
+package accesstype
+
+import (
+	"reflect"
+	"testing"
+
+	clientTypes "github.com/inonius/v3cli/api/client"
+	v3 "github.com/inonius/v3cli/api/v3"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name   string
+		isIPv4 bool
+		mr     v3.MSSResponse
+		want   clientTypes.AccessTypeGuess
+	}{
+		{
+			name:   "IPv4 PPPoE of FLET'S",
+			isIPv4: true,
+			mr:     v3.MSSResponse{ActualMss: 1402, Mss: 1414, IsIPv4: true, EstinamtedMtu: 1454},
+			want:   clientTypes.AccessTypeGuess{Name: "PPPoE", Confidence: 0.9, Mtu: 1454, Candidates: []clientTypes.AccessTypeCandidate{candidate("PPPoE", 0.9)}},
+		},
+		{
+			name: "IPv6 PPPoE of FLET'S",
+			mr:   v3.MSSResponse{ActualMss: 1382, Mss: 1394, EstinamtedMtu: 1454},
+			want: clientTypes.AccessTypeGuess{Name: "PPPoE", Confidence: 0.9, Mtu: 1454, Candidates: []clientTypes.AccessTypeCandidate{candidate("PPPoE", 0.9)}},
+		},
+		{
+			name: "IPv6 IPoE",
+			mr:   v3.MSSResponse{ActualMss: 1428, Mss: 1440, EstinamtedMtu: 1500},
+			want: clientTypes.AccessTypeGuess{Name: "IPoE", Confidence: 0.8, Mtu: 1500, Candidates: []clientTypes.AccessTypeCandidate{candidate("IPoE", 0.8)}},
+		},
+		{
+			name:   "IPv4 IPoE",
+			isIPv4: true,
+			mr:     v3.MSSResponse{ActualMss: 1448, Mss: 1460, IsIPv4: true, EstinamtedMtu: 1500},
+			want:   clientTypes.AccessTypeGuess{Name: "IPoE", Confidence: 0.8, Mtu: 1500, Candidates: []clientTypes.AccessTypeCandidate{candidate("IPoE", 0.8)}},
+		},
+		{
+			name:   "IPv4 over IPv6 is ambiguous",
+			isIPv4: true,
+			mr:     v3.MSSResponse{ActualMss: 1408, Mss: 1420, IsIPv4: true, EstinamtedMtu: 1460},
+			want: clientTypes.AccessTypeGuess{Name: "DS-Lite/MAP-E", Confidence: 0.45, Mtu: 1460, Ambiguous: true,
+				Candidates: []clientTypes.AccessTypeCandidate{candidate("DS-Lite", 0.45), candidate("MAP-E", 0.45)}},
+		},
+		{
+			name:   "estimated MTU first",
+			isIPv4: true,
+			mr:     v3.MSSResponse{ActualMss: 1402, Mss: 1414, IsIPv4: true, EstinamtedMtu: 1460},
+			want: clientTypes.AccessTypeGuess{Name: "DS-Lite/MAP-E", Confidence: 0.45, Mtu: 1460, Ambiguous: true,
+				Candidates: []clientTypes.AccessTypeCandidate{candidate("DS-Lite", 0.45), candidate("MAP-E", 0.45)}},
+		},
+		{
+			name:   "actual MSS without estimated MTU",
+			isIPv4: true,
+			mr:     v3.MSSResponse{ActualMss: 1402, Mss: 1414, IsIPv4: true},
+			want:   clientTypes.AccessTypeGuess{Name: "PPPoE", Confidence: 0.9, Mtu: 1454, Candidates: []clientTypes.AccessTypeCandidate{candidate("PPPoE", 0.9)}},
+		},
+		{
+			name: "MSS only",
+			mr:   v3.MSSResponse{Mss: 1440},
+			want: clientTypes.AccessTypeGuess{Name: "IPoE", Confidence: 0.8, Mtu: 1500, Candidates: []clientTypes.AccessTypeCandidate{candidate("IPoE", 0.8)}},
+		},
+		{
+			name:   "near match",
+			isIPv4: true,
+			mr:     v3.MSSResponse{Mss: 1415, IsIPv4: true, EstinamtedMtu: 1455},
+			want:   clientTypes.AccessTypeGuess{Name: "PPPoE", Confidence: 0.79, Mtu: 1455, Candidates: []clientTypes.AccessTypeCandidate{candidate("PPPoE", 0.79)}},
+		},
+		{
+			name:   "tunnels sharing an MTU",
+			isIPv4: true,
+			mr:     v3.MSSResponse{Mss: 1440, IsIPv4: true, EstinamtedMtu: 1480},
+			want: clientTypes.AccessTypeGuess{Name: "464XLAT", Confidence: 0.5, Mtu: 1480,
+				Candidates: []clientTypes.AccessTypeCandidate{candidate("464XLAT", 0.5), candidate("IPIP", 0.3), candidate("GRE", 0.3)}},
+		},
+		{
+			name: "IPv6 minimum MTU",
+			mr:   v3.MSSResponse{Mss: 1220, EstinamtedMtu: 1280},
+			want: clientTypes.AccessTypeGuess{Name: "MinimumIPv6", Confidence: 0.4, Mtu: 1280, Candidates: []clientTypes.AccessTypeCandidate{candidate("MinimumIPv6", 0.4)}},
+		},
+		{
+			name:   "no rule",
+			isIPv4: true,
+			mr:     v3.MSSResponse{Mss: 1360, IsIPv4: true, EstinamtedMtu: 1400},
+			want:   clientTypes.AccessTypeGuess{Name: Unknown, Mtu: 1400},
+		},
+		{
+			name: "no MSS",
+			want: clientTypes.AccessTypeGuess{Name: Unknown},
+		},
+	}
+	c := NewClassifier(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.Classify(tt.isIPv4, tt.mr); !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("Classify() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewClassifier(t *testing.T) {
+	c := NewClassifier([]Rule{
+		{Name: "ipoe", Mtu: 1500, Confidence: 0.95},
+		{Name: "Corporate VPN", Family: FamilyIPv4, Mtu: 1400, Confidence: 0.7},
+	})
+	tests := []struct {
+		name string
+		mr   v3.MSSResponse
+		want string
+	}{
+		{"extra rule replaces the default one", v3.MSSResponse{EstinamtedMtu: 1500}, "ipoe"},
+		{"extra rule", v3.MSSResponse{EstinamtedMtu: 1400}, "Corporate VPN"},
+		{"default rules are kept", v3.MSSResponse{EstinamtedMtu: 1454}, "PPPoE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.Classify(true, tt.mr); got.Name != tt.want {
+				t.Errorf("Classify() = %s, want %s", got.Name, tt.want)
+			}
+		})
+	}
+	if got, want := len(c.Rules()), len(DefaultRules())+1; got != want {
+		t.Errorf("got %d rules, want %d", got, want)
+	}
+}
+
+func candidate(name string, confidence float64) clientTypes.AccessTypeCandidate {
+	return clientTypes.AccessTypeCandidate{Name: name, Confidence: confidence}
+}
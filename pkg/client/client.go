@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -60,6 +61,35 @@ func (c *SpeedtestClient) GetMSS(ctx context.Context, isIPv4 bool) (v3.MSSRespon
 	return mr, err
 }
 
+// GetOneshotMSS queries the /mss of a MSS oneshot server, forced to the family like the api endpoints
+func (c *SpeedtestClient) GetOneshotMSS(ctx context.Context, endpoint string, isIPv4 bool) (v3.MSSResponse, error) {
+	mr := v3.MSSResponse{}
+	if err := c.callWith(ctx, c.familyHTTPClient(isIPv4), "GET", endpoint, "/mss", nil, &mr); err != nil {
+		return mr, err
+	}
+	if mr.IsIPv4 != isIPv4 {
+		return mr, fmt.Errorf("%s answered on the other family", endpoint)
+	}
+	return mr, nil
+}
+
+// familyHTTPClient is the api client restricted to tcp4 or tcp6
+func (c *SpeedtestClient) familyHTTPClient(isIPv4 bool) *http.Client {
+	network := "tcp6"
+	if isIPv4 {
+		network = "tcp4"
+	}
+	transport := c.v3Client.HttpClient.Transport.(*http.Transport).Clone()
+	dial := transport.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	transport.DialContext = func(ctx context.Context, _, address string) (net.Conn, error) {
+		return dial(ctx, network, address)
+	}
+	return &http.Client{Transport: transport, Timeout: c.v3Client.HttpClient.Timeout}
+}
+
 func ConvertLibrespeedToServer(lts v3.LibrespeedTestServer, id int) defs.Server {
 	return defs.Server{
 		ID:          id,
@@ -84,12 +114,28 @@ func (c *SpeedtestClient) GetServers(ctx context.Context) (v3.TestServersList, e
 	return tsl, err
 }
 
+// OneshotServers returns the oneshot servers of the given type
+func OneshotServers(servers []v3.OneshotTestServer, typeName v3.OneshotTestServerType) []v3.OneshotTestServer {
+	var filtered []v3.OneshotTestServer
+	for _, s := range servers {
+		if s.TypeName == typeName {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered
+}
+
 func ConvertLibrespeedServersToDefsServers(libreServers []v3.LibrespeedTestServer) (ipv4 []defs.Server, ipv6 []defs.Server) {
 	var ipv4defsServers []defs.Server
 	var ipv6defsServers []defs.Server
 
 	for i, ls := range libreServers {
-		server := ConvertLibrespeedToServer(ls, i+1)
+		// the id of the api stays the same when servers are added or removed, unlike the position
+		id := int(ls.ID)
+		if id == 0 {
+			id = i + 1
+		}
+		server := ConvertLibrespeedToServer(ls, id)
 		switch ls.TypeName {
 		case "ipv4":
 			ipv4defsServers = append(ipv4defsServers, server)
@@ -215,6 +261,10 @@ func (c *SpeedtestClient) FinishSpeedtestSession(ctx context.Context) error {
 }
 
 func (c *SpeedtestClient) call(ctx context.Context, method string, endpoint string, apiEndpoint string, params interface{}, res interface{}) error {
+	return c.callWith(ctx, c.v3Client.HttpClient, method, endpoint, apiEndpoint, params, res)
+}
+
+func (c *SpeedtestClient) callWith(ctx context.Context, httpClient *http.Client, method string, endpoint string, apiEndpoint string, params interface{}, res interface{}) error {
 	// thx: https://qiita.com/yyoshiki41/items/a0354d9ad70c1b8225b6
 	if (endpoint) == "" {
 		return fmt.Errorf("endpoint is not set")
@@ -238,7 +288,7 @@ func (c *SpeedtestClient) call(ctx context.Context, method string, endpoint stri
 	req.Header.Add("User-Agent", "inonius_v3cli"+"_"+Version)
 	req = req.WithContext(ctx)
 
-	response, err := c.v3Client.HttpClient.Do(req)
+	response, err := httpClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -252,9 +302,16 @@ func (c *SpeedtestClient) call(ctx context.Context, method string, endpoint stri
 
 func simplifiedResult(result clientTypes.Result) clientTypes.SimplifiedResult {
 	simplifiedResult := clientTypes.SimplifiedResult{
-		Timestamp:     result.Session.CreatedAt.Unix(),
-		IPv4Available: result.IPv4Available,
-		IPv6Available: result.IPv6Available,
+		SchemaVersion: clientTypes.SimplifiedResultSchemaVersion,
+		// [] rather than null when every speedtest failed
+		SpeedtestResult: []clientTypes.SimplifiedSpeedtestResult{},
+		Timestamp:       result.Session.CreatedAt.Unix(),
+		IPv4Available:   result.IPv4Available,
+		IPv6Available:   result.IPv6Available,
+		Flets:           result.AccessTypeSession.Flets,
+		MSS:             result.MSSResults,
+		QUIC:            result.QUICResults,
+		Parameters:      &result.Parameters,
 	}
 
 	if result.IPv4Available {
@@ -265,17 +322,27 @@ func simplifiedResult(result clientTypes.Result) clientTypes.SimplifiedResult {
 			Org:    result.ClientInfoPair.IPv4Info.IPInfo.Org,
 			Mss:    result.AccessTypeSession.IPv4Mss,
 		}
+		if ct := result.AccessTypeSession.IPv4ConnectionType; ct != nil {
+			simplifiedResult.IPv4Info.ConnectionType = &clientTypes.SimplifiedConnectionType{Name: ct.Name, Mss: ct.Mss}
+		}
+		simplifiedResult.IPv4Info.LocalConnectionType = result.AccessTypeGuess.IPv4
 
-		if ipv4Result := result.SpeedtestResultPair.IPv4Result; ipv4Result != nil {
+		for _, ipv4Result := range result.SpeedtestResultPair.IPv4Results {
 			simplifiedResult.SpeedtestResult = append(simplifiedResult.SpeedtestResult, clientTypes.SimplifiedSpeedtestResult{
 				SpeedtestType: "IPv4",
 				UnixTime:      ipv4Result.Timestamp.Unix(),
 				Server:        ipv4Result.Server.Name,
-				Upload:        ipv4Result.Upload,
-				Download:      ipv4Result.Download,
+				Upload:        skippable(ipv4Result.Upload, ipv4Result.UploadSkipped),
+				Download:      skippable(ipv4Result.Download, ipv4Result.DownloadSkipped),
 				Ping:          ipv4Result.Ping,
 				Jitter:        ipv4Result.Jitter,
+				Bufferbloat:   ipv4Result.Bufferbloat,
 			})
+			if result.Parameters.Samples {
+				r := &simplifiedResult.SpeedtestResult[len(simplifiedResult.SpeedtestResult)-1]
+				r.DownloadDetail = ipv4Result.DownloadDetail
+				r.UploadDetail = ipv4Result.UploadDetail
+			}
 		}
 	}
 
@@ -287,18 +354,36 @@ func simplifiedResult(result clientTypes.Result) clientTypes.SimplifiedResult {
 			Org:    result.ClientInfoPair.IPv6Info.IPInfo.Org,
 			Mss:    result.AccessTypeSession.IPv6Mss,
 		}
+		if ct := result.AccessTypeSession.IPv6ConnectionType; ct != nil {
+			simplifiedResult.IPv6Info.ConnectionType = &clientTypes.SimplifiedConnectionType{Name: ct.Name, Mss: ct.Mss}
+		}
+		simplifiedResult.IPv6Info.LocalConnectionType = result.AccessTypeGuess.IPv6
 
-		if ipv6Result := result.SpeedtestResultPair.IPv6Result; ipv6Result != nil {
+		for _, ipv6Result := range result.SpeedtestResultPair.IPv6Results {
 			simplifiedResult.SpeedtestResult = append(simplifiedResult.SpeedtestResult, clientTypes.SimplifiedSpeedtestResult{
 				SpeedtestType: "IPv6",
 				UnixTime:      ipv6Result.Timestamp.Unix(),
 				Server:        ipv6Result.Server.Name,
-				Upload:        ipv6Result.Upload,
-				Download:      ipv6Result.Download,
+				Upload:        skippable(ipv6Result.Upload, ipv6Result.UploadSkipped),
+				Download:      skippable(ipv6Result.Download, ipv6Result.DownloadSkipped),
 				Ping:          ipv6Result.Ping,
 				Jitter:        ipv6Result.Jitter,
+				Bufferbloat:   ipv6Result.Bufferbloat,
 			})
+			if result.Parameters.Samples {
+				r := &simplifiedResult.SpeedtestResult[len(simplifiedResult.SpeedtestResult)-1]
+				r.DownloadDetail = ipv6Result.DownloadDetail
+				r.UploadDetail = ipv6Result.UploadDetail
+			}
 		}
 	}
 	return simplifiedResult
 }
+
+// skippable returns nil for a skipped phase so that it is absent rather than 0
+func skippable(value float64, skipped bool) *float64 {
+	if skipped {
+		return nil
+	}
+	return &value
+}
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	v3 "github.com/inonius/v3cli/api/v3"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var clientInfoCmd *cobra.Command = &cobra.Command{
+	Use:   "clientinfo",
+	Short: "Show the client address and ipinfo seen by the api",
+	Args:  cobra.NoArgs,
+	RunE:  clientInfoFn,
+}
+
+type familyClientInfo struct {
+	Family     string         `json:"family"`
+	Available  bool           `json:"available"`
+	ClientInfo *v3.ClientInfo `json:"client_info,omitempty"`
+}
+
+func clientInfoFn(cmd *cobra.Command, args []string) error {
+	clientInstance, err := newClientInstance()
+	if err != nil {
+		return err
+	}
+	speedtestClient := NewSpeedtestClient(clientInstance)
+	ctx := context.Background()
+
+	var infos []familyClientInfo
+	for _, isIPv4 := range targetFamilies() {
+		info := familyClientInfo{Family: familyName(isIPv4)}
+		ci, err := speedtestClient.GetClientInfo(ctx, isIPv4)
+		if err != nil {
+			logger.Debug("failed to get clientInfo", "family", info.Family, "error", err.Error())
+		} else {
+			info.Available = true
+			info.ClientInfo = &ci
+		}
+		infos = append(infos, info)
+	}
+
+	if jsonOutput() {
+		return printJSON(infos)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FAMILY\tIP\tPORT\tORG\tCOUNTRY\tCITY")
+	for _, info := range infos {
+		if !info.Available {
+			fmt.Fprintf(w, "%s\t%s\t\t\t\t\n", info.Family, "not available")
+			continue
+		}
+		ci := info.ClientInfo
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", info.Family, ci.IP.String(), ci.Port, ci.IPInfo.Org, ci.IPInfo.Country, ci.IPInfo.City)
+	}
+	return w.Flush()
+}
+
+// targetFamilies returns the families to query, true means IPv4
+func targetFamilies() []bool {
+	switch {
+	case viper.GetBool("ipv4"):
+		return []bool{true}
+	case viper.GetBool("ipv6"):
+		return []bool{false}
+	default:
+		return []bool{true, false}
+	}
+}
+
+func familyName(isIPv4 bool) string {
+	if isIPv4 {
+		return "IPv4"
+	}
+	return "IPv6"
+}
+
+func init() {
+	cmd.AddCommand(clientInfoCmd)
+}
@@ -0,0 +1,416 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	clientTypes "github.com/inonius/v3cli/api/client"
+	"github.com/inonius/v3cli/pkg/speedtest"
+	"github.com/spf13/cobra"
+)
+
+var compareCmd *cobra.Command = &cobra.Command{
+	Use:   "compare <RUN> [RUN]",
+	Short: "Compare two runs, or IPv4 and IPv6 of a single run",
+	Long: "Compare two runs, or IPv4 and IPv6 of a single run.\n" +
+		"A run is a session UUID (or a unique prefix) of the history, or a file of the --json or --output json:full output, - reads stdin.\n" +
+		"The first result of each family is compared, the rates of the second run are converted into the unit of the first one.",
+	Args: cobra.RangeArgs(1, 2),
+	RunE: compareFn,
+}
+
+// compareRun is a run reduced to what is compared, a family is nil when it is not available
+type compareRun struct {
+	Label string
+	Time  time.Time
+	Unit  string
+	IPv4  *compareSide
+	IPv6  *compareSide
+}
+
+func (r *compareRun) title() string {
+	if r.Time.IsZero() {
+		return r.Label
+	}
+	return r.Label + " (" + r.Time.Local().Format("2006-01-02 15:04") + ")"
+}
+
+type compareSide struct {
+	Address    string
+	AccessType string // detected by the api
+	Mss        *int
+	Server     string
+	Download   *float64 // nil when skipped or when every speedtest failed
+	Upload     *float64
+	Ping       *float64
+	Jitter     *float64
+}
+
+// compareMetric is a row of the comparison, Family is empty when IPv4 is compared to IPv6
+type compareMetric struct {
+	Family string      `json:"family,omitempty"`
+	Metric string      `json:"metric"`
+	Unit   string      `json:"unit,omitempty"`
+	A      interface{} `json:"a"`
+	B      interface{} `json:"b"`
+	Delta  *float64    `json:"delta,omitempty"`  // b - a
+	Change *float64    `json:"change,omitempty"` // relative to a
+}
+
+type comparison struct {
+	A       string          `json:"a"`
+	B       string          `json:"b"`
+	Metrics []compareMetric `json:"metrics"`
+}
+
+func compareFn(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	runs := make([]*compareRun, len(args))
+	for i, arg := range args {
+		run, err := loadCompareRun(arg)
+		if err != nil {
+			return err
+		}
+		runs[i] = run
+	}
+
+	c, err := compareRuns(runs)
+	if err != nil {
+		return err
+	}
+	if jsonOutput() {
+		return printJSON(c)
+	}
+	return writeComparison(os.Stdout, c, len(runs) == 1)
+}
+
+// compareRuns compares IPv4 to IPv6 of a single run, or the second run to the first one family by family
+func compareRuns(runs []*compareRun) (comparison, error) {
+	if len(runs) == 1 {
+		run := runs[0]
+		if run.IPv4 == nil || run.IPv6 == nil {
+			return comparison{}, fmt.Errorf("%s was not measured on both IPv4 and IPv6", run.Label)
+		}
+		return comparison{A: "IPv4", B: "IPv6", Metrics: compareSides("", run.IPv4, run.IPv6, run.Unit, run.Unit)}, nil
+	}
+
+	a, b := runs[0], runs[1]
+	c := comparison{A: a.title(), B: b.title(), Metrics: []compareMetric{}}
+	for _, family := range []struct {
+		name string
+		a, b *compareSide
+	}{{"IPv4", a.IPv4, b.IPv4}, {"IPv6", a.IPv6, b.IPv6}} {
+		if family.a == nil && family.b == nil {
+			continue
+		}
+		c.Metrics = append(c.Metrics, compareSides(family.name, family.a, family.b, a.Unit, b.Unit)...)
+	}
+	return c, nil
+}
+
+// loadCompareRun reads a result file when arg is an existing file or -, a run of the history otherwise
+func loadCompareRun(arg string) (*compareRun, error) {
+	if arg != "-" {
+		if _, err := os.Stat(arg); err != nil {
+			return historyCompareRun(arg)
+		}
+	}
+
+	var b []byte
+	var err error
+	if arg == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(arg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// json:full has the client info and the raw speedtest results, --json the simplified ones
+	var probe struct {
+		ClientInfo json.RawMessage `json:"client_info"`
+	}
+	if err := json.Unmarshal(b, &probe); err != nil {
+		return nil, fmt.Errorf("%s: %w", arg, err)
+	}
+	if probe.ClientInfo != nil {
+		full := clientTypes.FullResult{Result: &clientTypes.Result{}}
+		if err := json.Unmarshal(b, &full); err != nil {
+			return nil, fmt.Errorf("%s: %w", arg, err)
+		}
+		return resultCompareRun(arg, full.Result), nil
+	}
+	var sr clientTypes.SimplifiedResult
+	if err := json.Unmarshal(b, &sr); err != nil {
+		return nil, fmt.Errorf("%s: %w", arg, err)
+	}
+	return simplifiedCompareRun(arg, &sr), nil
+}
+
+func historyCompareRun(uuid string) (*compareRun, error) {
+	store, err := openHistory()
+	if err != nil {
+		return nil, fmt.Errorf("%s is neither a file nor a saved run: %w", uuid, err)
+	}
+	defer store.Close()
+
+	run, err := store.Run(uuid)
+	if err != nil {
+		return nil, err
+	}
+	return resultCompareRun(shortUUID(run.UUID), run.Result), nil
+}
+
+func resultCompareRun(label string, result *clientTypes.Result) *compareRun {
+	run := &compareRun{Label: label, Time: result.Session.CreatedAt, Unit: result.Parameters.Unit}
+	if result.IPv4Available {
+		run.IPv4 = resultCompareSide(result, true)
+	}
+	if result.IPv6Available {
+		run.IPv6 = resultCompareSide(result, false)
+	}
+	return run
+}
+
+// resultCompareSide takes the first result of the family in the SpeedtestResultPair
+func resultCompareSide(result *clientTypes.Result, isIPv4 bool) *compareSide {
+	ats := result.AccessTypeSession
+	info, mss, ct, results := result.ClientInfoPair.IPv6Info, ats.IPv6Mss, ats.IPv6ConnectionType, result.SpeedtestResultPair.IPv6Results
+	if isIPv4 {
+		info, mss, ct, results = result.ClientInfoPair.IPv4Info, ats.IPv4Mss, ats.IPv4ConnectionType, result.SpeedtestResultPair.IPv4Results
+	}
+
+	side := &compareSide{Address: info.IP.String(), Mss: mss}
+	if ct != nil {
+		side.AccessType = ct.Name
+	}
+	if len(results) > 0 {
+		r := results[0]
+		side.Server = r.Server.Name
+		side.Download = skippable(r.Download, r.DownloadSkipped)
+		side.Upload = skippable(r.Upload, r.UploadSkipped)
+		side.Ping, side.Jitter = &r.Ping, &r.Jitter
+	}
+	return side
+}
+
+func simplifiedCompareRun(label string, sr *clientTypes.SimplifiedResult) *compareRun {
+	run := &compareRun{Label: label, Unit: "Mbps"}
+	if sr.Timestamp > 0 {
+		run.Time = time.Unix(sr.Timestamp, 0)
+	}
+	if sr.Parameters != nil {
+		run.Unit = sr.Parameters.Unit
+	}
+	for _, family := range []struct {
+		side      **compareSide
+		available bool
+		info      *clientTypes.SimplifiedClientInfo
+		name      string
+	}{{&run.IPv4, sr.IPv4Available, sr.IPv4Info, "IPv4"}, {&run.IPv6, sr.IPv6Available, sr.IPv6Info, "IPv6"}} {
+		if !family.available || family.info == nil {
+			continue
+		}
+		side := &compareSide{Address: family.info.IP.String(), Mss: family.info.Mss}
+		if family.info.ConnectionType != nil {
+			side.AccessType = family.info.ConnectionType.Name
+		}
+		for _, r := range sr.SpeedtestResult {
+			if r.SpeedtestType != family.name {
+				continue
+			}
+			side.Server = r.Server
+			side.Download, side.Upload = r.Download, r.Upload
+			side.Ping, side.Jitter = &r.Ping, &r.Jitter
+			break
+		}
+		*family.side = side
+	}
+	return run
+}
+
+// compareSides compares b to a, the rates of b are converted into the unit of a
+func compareSides(family string, a, b *compareSide, unitA, unitB string) []compareMetric {
+	if a == nil {
+		a = &compareSide{}
+	}
+	if b == nil {
+		b = &compareSide{}
+	}
+	var bDownload, bUpload *float64
+	if b.Download != nil {
+		v := speedtest.RoundTo(speedtest.Convert(*b.Download, unitB, unitA), 2)
+		bDownload = &v
+	}
+	if b.Upload != nil {
+		v := speedtest.RoundTo(speedtest.Convert(*b.Upload, unitB, unitA), 2)
+		bUpload = &v
+	}
+
+	metrics := []compareMetric{
+		numericMetric(family, "download", unitA, a.Download, bDownload),
+		numericMetric(family, "upload", unitA, a.Upload, bUpload),
+		numericMetric(family, "ping", "ms", a.Ping, b.Ping),
+		numericMetric(family, "jitter", "ms", a.Jitter, b.Jitter),
+	}
+	var mssA, mssB *float64
+	if a.Mss != nil {
+		v := float64(*a.Mss)
+		mssA = &v
+	}
+	if b.Mss != nil {
+		v := float64(*b.Mss)
+		mssB = &v
+	}
+	metrics = append(metrics, numericMetric(family, "mss", "", mssA, mssB))
+	for _, m := range []struct{ name, a, b string }{
+		{"access_type", a.AccessType, b.AccessType},
+		{"server", a.Server, b.Server},
+		{"address", a.Address, b.Address},
+	} {
+		metrics = append(metrics, compareMetric{Family: family, Metric: m.name, A: m.a, B: m.b})
+	}
+	return metrics
+}
+
+func numericMetric(family, metric, unit string, a, b *float64) compareMetric {
+	m := compareMetric{Family: family, Metric: metric, Unit: unit}
+	if a != nil {
+		m.A = *a
+	}
+	if b != nil {
+		m.B = *b
+	}
+	if a != nil && b != nil {
+		delta := speedtest.RoundTo(*b-*a, 2)
+		m.Delta = &delta
+		if *a != 0 {
+			change := speedtest.RoundTo((*b-*a) / *a, 3)
+			m.Change = &change
+		}
+	}
+	return m
+}
+
+var compareMetricNames = map[string]string{
+	"download":    "Download",
+	"upload":      "Upload",
+	"ping":        "RTT",
+	"jitter":      "Jitter",
+	"mss":         "MSS",
+	"access_type": "Access type",
+	"server":      "Server",
+	"address":     "Address",
+}
+
+func writeComparison(w io.Writer, c comparison, stacks bool) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "\t%s\t%s\tDELTA\n", c.A, c.B)
+	for _, m := range c.Metrics {
+		name := compareMetricNames[m.Metric]
+		if m.Family != "" {
+			name = m.Family + " " + name
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", name, compareValue(m.A, m.Unit), compareValue(m.B, m.Unit), compareDelta(m))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if stacks {
+		for _, line := range stackVerdicts(c) {
+			fmt.Fprintln(w, line)
+		}
+	}
+	return nil
+}
+
+func compareValue(v interface{}, unit string) string {
+	switch v := v.(type) {
+	case nil:
+		return "-"
+	case float64:
+		if unit == "" {
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		return fmt.Sprintf("%.2f %s", v, unit)
+	case string:
+		if v == "" {
+			return "-"
+		}
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+func compareDelta(m compareMetric) string {
+	if m.Delta == nil {
+		if a, ok := m.A.(string); ok && a != "" && m.B != nil && m.A != m.B && m.B != "" {
+			return "changed"
+		}
+		return ""
+	}
+	switch {
+	case m.Unit == "":
+		return fmt.Sprintf("%+g", *m.Delta)
+	case m.Change == nil:
+		return fmt.Sprintf("%+.2f", *m.Delta)
+	}
+	return fmt.Sprintf("%+.2f (%+.1f%%)", *m.Delta, *m.Change*100)
+}
+
+// stackVerdicts answer whether IPv6 is faster than IPv4 in words
+func stackVerdicts(c comparison) []string {
+	var accessA, accessB string
+	for _, m := range c.Metrics {
+		if m.Metric == "access_type" {
+			accessA, accessB = m.A.(string), m.B.(string)
+		}
+	}
+	label := func(family, accessType string) string {
+		if accessType == "" {
+			return family
+		}
+		return family + " (" + accessType + ")"
+	}
+	a, b := label(c.A, accessA), label(c.B, accessB)
+
+	var lines []string
+	for _, m := range c.Metrics {
+		if m.Change == nil {
+			continue
+		}
+		var word string
+		switch {
+		case m.Metric != "download" && m.Metric != "upload" && m.Metric != "ping":
+			continue
+		case *m.Change == 0:
+			lines = append(lines, fmt.Sprintf("%s: %s and %s are the same", compareMetricNames[m.Metric], b, a))
+			continue
+		case m.Metric == "ping" && *m.Change < 0:
+			word = "lower"
+		case m.Metric == "ping":
+			word = "higher"
+		case *m.Change < 0:
+			word = "slower"
+		default:
+			word = "faster"
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s is %.1f%% %s than %s", compareMetricNames[m.Metric], b, math.Abs(*m.Change)*100, word, a))
+	}
+	if len(lines) > 0 {
+		lines = append([]string{""}, lines...)
+	}
+	return lines
+}
+
+func init() {
+	cmd.AddCommand(compareCmd)
+}
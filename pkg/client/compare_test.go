@@ -0,0 +1,117 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func TestNumericMetric(t *testing.T) {
+	tests := []struct {
+		name          string
+		a, b          *float64
+		delta, change *float64
+	}{
+		{"faster", float(200), float(251.66), float(51.66), float(0.258)},
+		{"slower", float(100), float(75), float(-25), float(-0.25)},
+		{"same", float(7.25), float(7.25), float(0), float(0)},
+		{"rounded", float(0.1), float(0.3), float(0.2), float(2)},
+		{"from zero", float(0), float(5), float(5), nil},
+		{"skipped in a", nil, float(5), nil, nil},
+		{"skipped in b", float(5), nil, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := numericMetric("IPv4", "download", "Mbps", tt.a, tt.b)
+			if !reflect.DeepEqual(m.Delta, tt.delta) || !reflect.DeepEqual(m.Change, tt.change) {
+				t.Errorf("delta %v change %v, want %v %v", deref(m.Delta), deref(m.Change), deref(tt.delta), deref(tt.change))
+			}
+			if (tt.a == nil) != (m.A == nil) || (tt.b == nil) != (m.B == nil) {
+				t.Errorf("a %v b %v, a skipped side must be nil", m.A, m.B)
+			}
+		})
+	}
+}
+
+func deref(v *float64) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+func TestCompareSidesConvertsUnit(t *testing.T) {
+	a := &compareSide{Download: float(251.66), Upload: float(55.92)}
+	b := &compareSide{Download: float(31.4575), Upload: float(6.99)}
+	metrics := compareSides("IPv4", a, b, "Mbps", "MB/s")
+
+	download, upload := metrics[0], metrics[1]
+	if download.Unit != "Mbps" || download.B != 251.66 || *download.Delta != 0 {
+		t.Errorf("download = %+v, want 251.66 Mbps and no delta", download)
+	}
+	if upload.B != 55.92 || *upload.Delta != 0 {
+		t.Errorf("upload = %+v, want 55.92 Mbps and no delta", upload)
+	}
+}
+
+func TestCompareStacks(t *testing.T) {
+	sr := simplifiedResult(*testResult())
+	c, err := compareRuns([]*compareRun{simplifiedCompareRun("result.json", &sr)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeComparison(&buf, c, true); err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "compare_stacks.txt", buf.Bytes())
+}
+
+func TestCompareStacksNeedsBothFamilies(t *testing.T) {
+	result := testResult()
+	result.IPv6Available = false
+	sr := simplifiedResult(*result)
+	if _, err := compareRuns([]*compareRun{simplifiedCompareRun("result.json", &sr)}); err == nil {
+		t.Errorf("compareRuns() succeeded without IPv6")
+	}
+}
+
+func TestCompareRuns(t *testing.T) {
+	local := time.Local
+	time.Local = time.UTC
+	t.Cleanup(func() { time.Local = local })
+
+	a := simplifiedResult(*testResult())
+
+	// a later IPv4 only run in MB/s to another server
+	result := testResult()
+	result.Session.CreatedAt = result.Session.CreatedAt.Add(24 * time.Hour)
+	result.Parameters.Unit = "MB/s"
+	result.IPv6Available = false
+	r := result.SpeedtestResultPair.IPv4Results[0]
+	r.Server.Name = "Osaka=2"
+	r.Download, r.Upload, r.Ping, r.Jitter = 25, 6.99, 9.5, 0.5
+	b := simplifiedResult(*result)
+
+	c, err := compareRuns([]*compareRun{simplifiedCompareRun("a.json", &a), simplifiedCompareRun("b.json", &b)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeComparison(&buf, c, false); err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "compare_runs.txt", buf.Bytes())
+
+	j, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "compare_runs.json", append(j, '\n'))
+}
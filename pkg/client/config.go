@@ -0,0 +1,49 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+var configCmd *cobra.Command = &cobra.Command{
+	Use:   "config",
+	Short: "Show the effective configuration (flags, config file and defaults)",
+	Args:  cobra.NoArgs,
+	RunE:  configFn,
+}
+
+// secretSettings are redacted by config, whose output ends up in bug reports
+var secretSettings = []string{"influx-token"}
+
+func configFn(cmd *cobra.Command, args []string) error {
+	settings := viper.AllSettings()
+	delete(settings, "config")
+	delete(settings, "help")
+	for _, key := range secretSettings {
+		if v, ok := settings[key]; ok && v != "" {
+			settings[key] = "REDACTED"
+		}
+	}
+
+	if used := viper.ConfigFileUsed(); used != "" {
+		logger.Info("Using config file", "path", used)
+	}
+
+	if jsonOutput() {
+		return printJSON(settings)
+	}
+
+	y, err := yaml.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(y))
+	return nil
+}
+
+func init() {
+	cmd.AddCommand(configCmd)
+}
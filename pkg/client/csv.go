@@ -0,0 +1,103 @@
+package client
+
+import (
+	"encoding/csv"
+	"io"
+	"os"
+	"strconv"
+
+	clientTypes "github.com/inonius/v3cli/api/client"
+	"github.com/spf13/viper"
+)
+
+// csvHeader is the fixed column order of --output csv/tsv, columns are only ever appended
+var csvHeader = []string{
+	"speedtest_type", "timestamp", "server", "upload", "download", "unit", "ping", "jitter", "bufferbloat",
+	"ip", "port", "org", "mss", "connection_type", "local_connection_type", "flets",
+}
+
+func printDelimited(result *clientTypes.Result, comma rune) error {
+	return writeDelimited(os.Stdout, result, comma, !viper.GetBool("no-header"))
+}
+
+// writeDelimited writes one row per result, or a row with the client info only when a family has no result
+func writeDelimited(out io.Writer, result *clientTypes.Result, comma rune, header bool) error {
+	w := csv.NewWriter(out)
+	w.Comma = comma
+	if header {
+		if err := w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+
+	s := simplifiedResult(*result)
+	for _, family := range []struct {
+		name string
+		info *clientTypes.SimplifiedClientInfo
+	}{{"IPv4", s.IPv4Info}, {"IPv6", s.IPv6Info}} {
+		if family.info == nil {
+			continue
+		}
+		written := false
+		for _, r := range s.SpeedtestResult {
+			if r.SpeedtestType != family.name {
+				continue
+			}
+			if err := w.Write(csvRow(s, family.info, &r, result.Parameters.Unit)); err != nil {
+				return err
+			}
+			written = true
+		}
+		if !written {
+			row := csvRow(s, family.info, nil, result.Parameters.Unit)
+			row[0] = family.name
+			if err := w.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func csvRow(s clientTypes.SimplifiedResult, info *clientTypes.SimplifiedClientInfo, r *clientTypes.SimplifiedSpeedtestResult, unit string) []string {
+	row := make([]string, 0, len(csvHeader))
+	if r != nil {
+		var bufferbloat string
+		if r.Bufferbloat != nil {
+			bufferbloat = r.Bufferbloat.Grade
+		}
+		row = append(row, r.SpeedtestType, strconv.FormatInt(r.UnixTime, 10), r.Server,
+			formatFloatPtr(r.Upload), formatFloatPtr(r.Download), unit,
+			formatFloat(r.Ping), formatFloat(r.Jitter), bufferbloat)
+	} else {
+		row = append(row, "", strconv.FormatInt(s.Timestamp, 10), "", "", "", unit, "", "", "")
+	}
+
+	var mss, connectionType, localConnectionType, flets string
+	if info.Mss != nil {
+		mss = strconv.Itoa(*info.Mss)
+	}
+	if info.ConnectionType != nil {
+		connectionType = info.ConnectionType.Name
+	}
+	if info.LocalConnectionType != nil {
+		localConnectionType = info.LocalConnectionType.Name
+	}
+	if s.Flets != nil {
+		flets = string(*s.Flets)
+	}
+	return append(row, info.IP.String(), strconv.Itoa(info.Port), info.Org, mss, connectionType, localConnectionType, flets)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// formatFloatPtr leaves skipped phases empty
+func formatFloatPtr(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return formatFloat(*v)
+}
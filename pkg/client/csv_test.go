@@ -0,0 +1,39 @@
+package client
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteDelimited(t *testing.T) {
+	tests := []struct {
+		name   string
+		comma  rune
+		header bool
+	}{
+		{"result.csv", ',', true},
+		{"result.tsv", '\t', true},
+		{"result_no_header.csv", ',', false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeDelimited(&buf, testResult(), tt.comma, tt.header); err != nil {
+				t.Fatal(err)
+			}
+			golden(t, tt.name, buf.Bytes())
+		})
+	}
+}
+
+func TestWriteDelimitedWithoutResult(t *testing.T) {
+	result := testResult()
+	result.SpeedtestResultPair.IPv6Results = nil
+	result.IPv4Available = false
+
+	var buf bytes.Buffer
+	if err := writeDelimited(&buf, result, ',', true); err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "result_client_info_only.csv", buf.Bytes())
+}
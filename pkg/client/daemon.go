@@ -0,0 +1,220 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var daemonCmd *cobra.Command = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run the speedtest on a schedule until SIGTERM",
+	Long: "Run the speedtest every --interval, immediately at start, or at the times of --cron.\n" +
+		"Every run is written like a single run: to stdout in the --output format, to --influx-url and to --history.\n" +
+		"A failed run is retried, then the daemon waits for the next time.\n" +
+		"On SIGTERM or SIGINT the active run gets --shutdown-timeout to complete, then it is stopped and its session finished.\n" +
+		"--listen serves /metrics, /last.json and /healthz, --probe also /probe to measure on scrape.",
+	Args: cobra.NoArgs,
+	RunE: daemonFn,
+}
+
+// daemonSchedule resolves --interval and --cron, an interval starts with a run, a cron expression waits for its first time.
+// No schedule is --interval 0 with --listen, to only measure on /probe.
+func daemonSchedule() (cron.Schedule, bool, error) {
+	interval := viper.GetDuration("interval")
+	expr := viper.GetString("cron")
+	switch {
+	case expr != "" && viper.IsSet("interval") && interval > 0:
+		return nil, false, fmt.Errorf("--interval and --cron are exclusive")
+	case expr != "":
+		schedule, err := cron.ParseStandard(expr)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid --cron: %w", err)
+		}
+		return schedule, false, nil
+	case interval == 0 && viper.GetString("listen") != "":
+		return nil, false, nil
+	case interval < time.Minute:
+		return nil, false, fmt.Errorf("--interval must be at least 1m, or 0 with --listen")
+	}
+	return cron.Every(interval), true, nil
+}
+
+func daemonFn(cmd *cobra.Command, args []string) error {
+	schedule, runNow, err := daemonSchedule()
+	if err != nil {
+		return err
+	}
+	jitter := viper.GetDuration("jitter")
+	retries := viper.GetInt("retries")
+	retryDelay := viper.GetDuration("retry-delay")
+	shutdownTimeout := viper.GetDuration("shutdown-timeout")
+	if jitter < 0 || retries < 0 || retryDelay < 0 || shutdownTimeout < 0 {
+		return fmt.Errorf("--jitter, --retries, --retry-delay and --shutdown-timeout must not be negative")
+	}
+	// the flags are checked once, a run builds its own client instance
+	if _, err := newClientInstance(); err != nil {
+		return err
+	}
+	outputs, err := newRunOutputs()
+	if err != nil {
+		return err
+	}
+	defer outputs.Close()
+	cmd.SilenceUsage = true
+
+	stop, cancelStop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer cancelStop()
+
+	logger.Info("Starting iNonius daemon", "version", Version)
+	var exp *exporter
+	exporterDone := make(chan struct{})
+	if listen := viper.GetString("listen"); listen != "" {
+		exp = newExporter(viper.GetBool("probe"), viper.GetDuration("probe-timeout"))
+		if err := exp.listen(listen); err != nil {
+			return err
+		}
+		// stopped along with the active run
+		go func() {
+			<-stop.Done()
+			exp.shutdown(shutdownTimeout)
+			close(exporterDone)
+		}()
+	} else {
+		close(exporterDone)
+	}
+	stopped := func() error {
+		<-exporterDone
+		logger.Info("Stopped")
+		return nil
+	}
+
+	if schedule == nil {
+		<-stop.Done()
+		return stopped()
+	}
+	next := time.Now()
+	if !runNow {
+		next = schedule.Next(next)
+	}
+	for {
+		at := next
+		if jitter > 0 {
+			at = at.Add(time.Duration(rand.Int63n(int64(jitter))))
+		}
+		logger.Info("Next run", "at", at.Format(time.RFC3339))
+		timer := time.NewTimer(time.Until(at))
+		select {
+		case <-stop.Done():
+			timer.Stop()
+			return stopped()
+		case <-timer.C:
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			runWithRetries(ctx, stop, retries, retryDelay, outputs, exp)
+		}()
+		select {
+		case <-done:
+			cancel()
+		case <-stop.Done():
+			logger.Info("Stopping, waiting for the active run", "timeout", shutdownTimeout)
+			select {
+			case <-done:
+			case <-time.After(shutdownTimeout):
+				logger.Warn("Stopping the active run, its session is finished with what was measured")
+				cancel()
+				<-done
+			}
+			cancel()
+			return stopped()
+		}
+
+		// the next time after the scheduled one, a run longer than the interval skips the missed times
+		next = schedule.Next(next)
+		if now := time.Now(); next.Before(now) {
+			next = schedule.Next(now)
+		}
+	}
+}
+
+// runWithRetries runs once, and retries a failed run after retryDelay, doubled on each attempt.
+// With the exporter, a run waits for an active probe and its result is exported.
+// ctx stops the active run, stop only the wait before a retry so that a shutdown does not wait for it.
+func runWithRetries(ctx, stop context.Context, retries int, retryDelay time.Duration, outputs *runOutputs, exp *exporter) {
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		clientInstance, err := newClientInstance()
+		if err == nil {
+			run := func() error { return runOnce(ctx, clientInstance, outputs) }
+			if exp != nil {
+				err = exp.exclusive(ctx, run)
+			} else {
+				err = run()
+			}
+		}
+		switch {
+		case err == nil:
+			logger.Info("Run completed", "uuid", clientInstance.Result.Session.UUID)
+			if exp != nil {
+				exp.observe(clientInstance.Result, time.Since(start))
+			}
+			return
+		case ctx.Err() != nil:
+			logger.Warn("Run stopped", "error", err)
+			return
+		case attempt >= retries:
+			logger.Error("Run failed, waiting for the next time", "attempts", attempt+1, "error", err)
+			if exp != nil {
+				exp.observeFailure()
+			}
+			return
+		}
+
+		delay := retryDelay << attempt
+		logger.Warn("Run failed, retrying", "attempt", attempt+1, "in", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-stop.Done():
+			logger.Info("Stopping, the failed run is not retried")
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+func init() {
+	daemonCmd.Flags().DurationP("interval", "", time.Hour, "Time between the start of two runs, at least 1m")
+	daemonCmd.Flags().StringP("cron", "", "", "Run at the times of this cron expression instead of --interval, e.g. '0 */2 * * *' or @hourly")
+	daemonCmd.Flags().DurationP("jitter", "", 0, "Delay each run by a random duration up to this, so that a fleet does not test at the same time")
+	daemonCmd.Flags().IntP("retries", "", 2, "Retries of a failed run before waiting for the next time")
+	daemonCmd.Flags().DurationP("retry-delay", "", 30*time.Second, "Delay before the first retry, doubled on each retry")
+	daemonCmd.Flags().DurationP("shutdown-timeout", "", 30*time.Second, "Time given to the active run to complete on SIGTERM")
+	daemonCmd.Flags().StringP("listen", "", "", "Serve /metrics, /last.json and /healthz on this address, e.g. :9469")
+	daemonCmd.Flags().BoolP("probe", "", false, "Also serve /probe?family=ipv6&server=3 that measures on scrape like the blackbox_exporter")
+	daemonCmd.Flags().DurationP("probe-timeout", "", 2*time.Minute, "Timeout of a probe unless given by ?timeout= or the scrape timeout")
+
+	viper.BindPFlag("interval", daemonCmd.Flags().Lookup("interval"))
+	viper.BindPFlag("cron", daemonCmd.Flags().Lookup("cron"))
+	viper.BindPFlag("jitter", daemonCmd.Flags().Lookup("jitter"))
+	viper.BindPFlag("retries", daemonCmd.Flags().Lookup("retries"))
+	viper.BindPFlag("retry-delay", daemonCmd.Flags().Lookup("retry-delay"))
+	viper.BindPFlag("shutdown-timeout", daemonCmd.Flags().Lookup("shutdown-timeout"))
+	viper.BindPFlag("listen", daemonCmd.Flags().Lookup("listen"))
+	viper.BindPFlag("probe", daemonCmd.Flags().Lookup("probe"))
+	viper.BindPFlag("probe-timeout", daemonCmd.Flags().Lookup("probe-timeout"))
+
+	cmd.AddCommand(daemonCmd)
+}
@@ -0,0 +1,30 @@
+package client
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestRunWithRetriesStopsDuringTheDelay(t *testing.T) {
+	// every attempt fails at once, an IPv6 source cannot be bound to IPv4
+	setViper(t, "ipv4", true)
+	setViper(t, "source", "::1")
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	t.Cleanup(func() { logger = nil })
+
+	stop, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runWithRetries(context.Background(), stop, 3, time.Hour, nil, nil)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("runWithRetries waited for the retry delay after the stop")
+	}
+}
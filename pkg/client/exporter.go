@@ -0,0 +1,283 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	clientTypes "github.com/inonius/v3cli/api/client"
+	"github.com/inonius/v3cli/pkg/speedtest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// exporter serves the results of the daemon: /metrics, /last.json, /healthz and with --probe /probe
+type exporter struct {
+	server       *http.Server
+	probeTimeout time.Duration
+
+	// tests is held by the measurement in progress, scheduled or probed, so that two never run at the same time
+	tests chan struct{}
+
+	mu   sync.Mutex
+	last *clientTypes.Result
+
+	// across the runs of the daemon, the last result is rendered by resultRegistry on each scrape
+	registry *prometheus.Registry
+	runs     *prometheus.CounterVec
+	duration prometheus.Histogram
+	download *prometheus.HistogramVec
+	upload   *prometheus.HistogramVec
+	ping     *prometheus.SummaryVec
+	jitter   *prometheus.SummaryVec
+}
+
+func newExporter(probe bool, probeTimeout time.Duration) *exporter {
+	throughputBuckets := prometheus.ExponentialBuckets(1e6, 2, 17) // 1Mbps to 65Gbps
+	rttObjectives := map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}
+	e := &exporter{
+		probeTimeout: probeTimeout,
+		tests:        make(chan struct{}, 1),
+		registry:     prometheus.NewRegistry(),
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricNamespace, Name: "runs_total", Help: "Scheduled runs of the daemon by result: success or failure",
+		}, []string{"result"}),
+		duration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricNamespace, Name: "run_duration_seconds", Help: "Duration of the successful runs",
+			Buckets: prometheus.ExponentialBuckets(15, 1.5, 10),
+		}),
+		download: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricNamespace, Name: "runs_download_bits_per_second", Help: "Download throughput across the runs",
+			Buckets: throughputBuckets,
+		}, []string{"family"}),
+		upload: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricNamespace, Name: "runs_upload_bits_per_second", Help: "Upload throughput across the runs",
+			Buckets: throughputBuckets,
+		}, []string{"family"}),
+		ping: prometheus.NewSummaryVec(prometheus.SummaryOpts{
+			Namespace: metricNamespace, Name: "runs_ping_seconds", Help: "Idle round trip time across the runs of the last 24 hours",
+			Objectives: rttObjectives, MaxAge: 24 * time.Hour,
+		}, []string{"family"}),
+		jitter: prometheus.NewSummaryVec(prometheus.SummaryOpts{
+			Namespace: metricNamespace, Name: "runs_jitter_seconds", Help: "Jitter of the idle round trip time across the runs of the last 24 hours",
+			Objectives: rttObjectives, MaxAge: 24 * time.Hour,
+		}, []string{"family"}),
+	}
+	e.registry.MustRegister(e.runs, e.duration, e.download, e.upload, e.ping, e.jitter,
+		collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	// both results are exported from the start
+	e.runs.WithLabelValues("success")
+	e.runs.WithLabelValues("failure")
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(prometheus.GathererFunc(e.gather), promhttp.HandlerOpts{}))
+	mux.HandleFunc("/last.json", e.lastHandler)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	if probe {
+		mux.HandleFunc("/probe", e.probeHandler)
+	}
+	e.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	return e
+}
+
+// listen binds addr first, so that a port in use is an error of the command
+func (e *exporter) listen(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("invalid --listen: %w", err)
+	}
+	logger.Info("Serving the metrics", "address", ln.Addr().String())
+	go func() {
+		if err := e.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logger.Error("Metrics server stopped", "error", err)
+		}
+	}()
+	return nil
+}
+
+// shutdown waits up to timeout for the active requests, then stops the active probe
+func (e *exporter) shutdown(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := e.server.Shutdown(ctx); err == nil {
+		return
+	}
+	// closing the connection cancels the probe, which still finishes its session before releasing the tests
+	logger.Warn("Stopping the active probe")
+	e.server.Close()
+	finishCtx, cancelFinish := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancelFinish()
+	e.exclusive(finishCtx, func() error { return nil })
+}
+
+// exclusive runs f once no other test is running, or fails when ctx is done first.
+// Every scheduled run and probe must go through it: a measurement replaces the process-wide
+// http.DefaultClient.Transport used by librespeed (see speedtest.setupTransport), which is only
+// safe while no other measurement is using it.
+func (e *exporter) exclusive(ctx context.Context, f func() error) error {
+	select {
+	case e.tests <- struct{}{}:
+	case <-ctx.Done():
+		return fmt.Errorf("another test is running: %w", ctx.Err())
+	}
+	defer func() { <-e.tests }()
+	return f()
+}
+
+// observe records a successful scheduled run
+func (e *exporter) observe(result *clientTypes.Result, duration time.Duration) {
+	e.mu.Lock()
+	e.last = result
+	e.mu.Unlock()
+
+	e.runs.WithLabelValues("success").Inc()
+	e.duration.Observe(duration.Seconds())
+	for _, family := range []struct {
+		name    string
+		results []*clientTypes.SpeedtestResult
+	}{
+		{"IPv4", result.SpeedtestResultPair.IPv4Results},
+		{"IPv6", result.SpeedtestResultPair.IPv6Results},
+	} {
+		for _, r := range family.results {
+			if !r.DownloadSkipped {
+				e.download.WithLabelValues(family.name).Observe(speedtest.BitsPerSecond(result.Parameters.Unit, r.Download))
+			}
+			if !r.UploadSkipped {
+				e.upload.WithLabelValues(family.name).Observe(speedtest.BitsPerSecond(result.Parameters.Unit, r.Upload))
+			}
+			e.ping.WithLabelValues(family.name).Observe(r.Ping / 1000)
+			e.jitter.WithLabelValues(family.name).Observe(r.Jitter / 1000)
+		}
+	}
+}
+
+// observeFailure records a scheduled run failed after its retries
+func (e *exporter) observeFailure() {
+	e.runs.WithLabelValues("failure").Inc()
+}
+
+func (e *exporter) lastResult() *clientTypes.Result {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.last
+}
+
+// gather adds the gauges of the last result to the metrics across the runs
+func (e *exporter) gather() ([]*dto.MetricFamily, error) {
+	gatherers := prometheus.Gatherers{e.registry}
+	if last := e.lastResult(); last != nil {
+		gatherers = append(gatherers, resultRegistry(last))
+	}
+	return gatherers.Gather()
+}
+
+// lastHandler serves the last result as with --output json:full
+func (e *exporter) lastHandler(w http.ResponseWriter, r *http.Request) {
+	last := e.lastResult()
+	if last == nil {
+		http.Error(w, "no result yet", http.StatusNotFound)
+		return
+	}
+	j, err := json.Marshal(fullResult(last))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+// probeHandler measures on scrape like the blackbox_exporter: /probe?family=ipv6&server=3&timeout=90s.
+// The result is only returned to the scraper, with probe_success and probe_duration_seconds.
+func (e *exporter) probeHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var forceIPv4, forceIPv6 bool
+	switch family := strings.ToLower(q.Get("family")); family {
+	case "":
+	case "ipv4", "4":
+		forceIPv4 = true
+	case "ipv6", "6":
+		forceIPv6 = true
+	default:
+		http.Error(w, fmt.Sprintf("invalid family %q, available: ipv4, ipv6", family), http.StatusBadRequest)
+		return
+	}
+	var servers []int
+	for _, s := range q["server"] {
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid server %q", s), http.StatusBadRequest)
+			return
+		}
+		servers = append(servers, id)
+	}
+	timeout := e.probeTimeout
+	if s := q.Get("timeout"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			http.Error(w, fmt.Sprintf("invalid timeout %q", s), http.StatusBadRequest)
+			return
+		}
+		timeout = d
+	}
+	// answer before the scraper gives up, with the same margin as the blackbox_exporter
+	if s := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); s != "" {
+		if secs, err := strconv.ParseFloat(s, 64); err == nil && secs > 1 {
+			timeout = min(timeout, time.Duration((secs-0.5)*float64(time.Second)))
+		}
+	}
+
+	clientInstance, err := newClientInstanceFor(forceIPv4, forceIPv6)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(servers) > 0 {
+		clientInstance.Config.Server = servers
+		clientInstance.Config.ServerName = nil
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	start := time.Now()
+	err = e.exclusive(ctx, func() error {
+		return measure(ctx, NewSpeedtestClient(clientInstance))
+	})
+	result := clientInstance.Result
+	switch {
+	case err != nil:
+	case ctx.Err() == context.DeadlineExceeded:
+		err = fmt.Errorf("timeout of %s exceeded", timeout)
+	case ctx.Err() != nil:
+		err = ctx.Err()
+	case result.Session.UUID == "":
+		err = errNoSession
+	case !hasResults(result):
+		err = errNoResult
+	}
+
+	registry := prometheus.NewRegistry()
+	success := prometheus.NewGauge(prometheus.GaugeOpts{Name: "probe_success", Help: "1 if the probe measured a result"})
+	duration := prometheus.NewGauge(prometheus.GaugeOpts{Name: "probe_duration_seconds", Help: "Duration of the probe"})
+	registry.MustRegister(success, duration)
+	duration.Set(time.Since(start).Seconds())
+	gatherers := prometheus.Gatherers{registry}
+	if err != nil {
+		logger.Warn("Probe failed", "query", r.URL.RawQuery, "error", err)
+	} else {
+		success.Set(1)
+		gatherers = append(gatherers, resultRegistry(result))
+	}
+	promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
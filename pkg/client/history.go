@@ -0,0 +1,302 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	clientTypes "github.com/inonius/v3cli/api/client"
+	"github.com/inonius/v3cli/pkg/history"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var historyCmd *cobra.Command = &cobra.Command{
+	Use:   "history",
+	Short: "List, show and delete the runs saved with --history",
+}
+
+var historyListCmd *cobra.Command = &cobra.Command{
+	Use:   "list",
+	Short: "List the saved runs, newest first",
+	Args:  cobra.NoArgs,
+	RunE:  historyListFn,
+}
+
+var historyShowCmd *cobra.Command = &cobra.Command{
+	Use:   "show <SESSION_UUID>",
+	Short: "Show a saved run, --output renders it like a new run",
+	Args:  cobra.ExactArgs(1),
+	RunE:  historyShowFn,
+}
+
+var historyDeleteCmd *cobra.Command = &cobra.Command{
+	Use:   "delete [SESSION_UUID...]",
+	Short: "Delete the given runs, or the runs matching the filters",
+	RunE:  historyDeleteFn,
+}
+
+func historyPath() string {
+	if path := viper.GetString("history-db"); path != "" {
+		return path
+	}
+	return history.DefaultPath()
+}
+
+// newHistoryStore opens the history database when --history is set
+func newHistoryStore() (*history.Store, error) {
+	if !viper.GetBool("history") {
+		return nil, nil
+	}
+	return history.Open(historyPath())
+}
+
+func saveHistory(store *history.Store, c *clientTypes.Client) error {
+	run, err := store.Save(c.Result, Version, c.Config.Interface, c.Config.Source)
+	if err != nil {
+		return fmt.Errorf("failed to save the result to the history: %w", err)
+	}
+	logger.Info("Result saved to the history", "uuid", run.UUID, "path", historyPath())
+	return nil
+}
+
+// historyFilter reads the filter flags shared by list and delete
+func historyFilter(cmd *cobra.Command) (history.Filter, error) {
+	var f history.Filter
+	now := time.Now()
+	var err error
+	since, _ := cmd.Flags().GetString("since")
+	if f.Since, err = parseHistoryTime(since, now); err != nil {
+		return f, fmt.Errorf("invalid --since: %w", err)
+	}
+	until, _ := cmd.Flags().GetString("until")
+	if f.Until, err = parseHistoryTime(until, now); err != nil {
+		return f, fmt.Errorf("invalid --until: %w", err)
+	}
+
+	family, _ := cmd.Flags().GetString("family")
+	switch strings.ToLower(family) {
+	case "":
+	case "ipv4", "4":
+		f.Family = familyName(true)
+	case "ipv6", "6":
+		f.Family = familyName(false)
+	default:
+		return f, fmt.Errorf("invalid --family %q, available: ipv4, ipv6", family)
+	}
+	f.Server, _ = cmd.Flags().GetString("server-name")
+	f.Interface, _ = cmd.Flags().GetString("interface")
+	return f, nil
+}
+
+// parseHistoryTime accepts a date, a date and time in local time, RFC 3339, or a duration before now like 7d or 12h
+func parseHistoryTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is neither a date, a time nor a duration like 7d", s)
+}
+
+func openHistory() (*history.Store, error) {
+	path := historyPath()
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("no history at %s, save runs with --history", path)
+	}
+	return history.Open(path)
+}
+
+func historyListFn(cmd *cobra.Command, args []string) error {
+	f, err := historyFilter(cmd)
+	if err != nil {
+		return err
+	}
+	f.Limit, _ = cmd.Flags().GetInt("limit")
+	cmd.SilenceUsage = true
+	store, err := openHistory()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	runs, err := store.Runs(f)
+	if err != nil {
+		return err
+	}
+	if jsonOutput() {
+		if runs == nil {
+			runs = []history.Run{}
+		}
+		return printJSON(runs)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "UUID\tTIME\tFAMILY\tSERVER\tDOWNLOAD\tUPLOAD\tRTT\tJITTER\tACCESS TYPE\tINTERFACE")
+	for _, run := range runs {
+		at := run.CreatedAt.Local().Format("2006-01-02 15:04")
+		if len(run.Results) == 0 {
+			fmt.Fprintf(w, "%s\t%s\t-\t-\t-\t-\t-\t-\t\t%s\n", shortUUID(run.UUID), at, run.Interface)
+		}
+		for _, r := range run.Results {
+			accessType := run.IPv6AccessType
+			if r.Family == familyName(true) {
+				accessType = run.IPv4AccessType
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%.2f ms\t%.2f ms\t%s\t%s\n", shortUUID(run.UUID), at, r.Family, r.Server,
+				formatRate(r.Download, r.Unit), formatRate(r.Upload, r.Unit), r.Ping, r.Jitter, accessType, run.Interface)
+		}
+	}
+	return w.Flush()
+}
+
+func historyShowFn(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	store, err := openHistory()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	run, err := store.Run(args[0])
+	if err != nil {
+		return err
+	}
+	if outputFormat() != OutputText {
+		return printResult(run.Result)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "UUID\t%s\n", run.UUID)
+	fmt.Fprintf(w, "Time\t%s\n", run.CreatedAt.Local().Format(time.RFC3339))
+	fmt.Fprintf(w, "Device\t%s\n", run.Result.Session.DeviceId)
+	fmt.Fprintf(w, "Client version\t%s\n", run.ClientVersion)
+	if run.Interface != "" {
+		fmt.Fprintf(w, "Interface\t%s\n", run.Interface)
+	}
+	if run.Source != "" {
+		fmt.Fprintf(w, "Source\t%s\n", run.Source)
+	}
+	for _, family := range []struct {
+		name, address, org, accessType string
+		mss                            *int
+	}{
+		{"IPv4", run.IPv4Address, run.Result.ClientInfoPair.IPv4Info.IPInfo.Org, run.IPv4AccessType, run.IPv4Mss},
+		{"IPv6", run.IPv6Address, run.Result.ClientInfoPair.IPv6Info.IPInfo.Org, run.IPv6AccessType, run.IPv6Mss},
+	} {
+		if family.address == "" {
+			fmt.Fprintf(w, "%s\tnot available\n", family.name)
+			continue
+		}
+		line := family.address
+		if family.org != "" {
+			line += " (" + family.org + ")"
+		}
+		if family.accessType != "" {
+			line += ", " + family.accessType
+		}
+		if family.mss != nil {
+			line += fmt.Sprintf(", MSS %d", *family.mss)
+		}
+		fmt.Fprintf(w, "%s\t%s\n", family.name, line)
+	}
+	if run.Flets != "" {
+		fmt.Fprintf(w, "FLET'S\t%s\n", run.Flets)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "FAMILY\tSERVER\tDOWNLOAD\tUPLOAD\tRTT\tJITTER")
+	for _, r := range run.Results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%.2f ms\t%.2f ms\n", r.Family, r.Server, formatRate(r.Download, r.Unit), formatRate(r.Upload, r.Unit), r.Ping, r.Jitter)
+	}
+	return w.Flush()
+}
+
+func historyDeleteFn(cmd *cobra.Command, args []string) error {
+	f, err := historyFilter(cmd)
+	if err != nil {
+		return err
+	}
+	all, _ := cmd.Flags().GetBool("all")
+	if len(args) == 0 && !all && f.Since.IsZero() && f.Until.IsZero() && f.Family == "" && f.Server == "" && f.Interface == "" {
+		return fmt.Errorf("give the runs to delete, a filter or --all")
+	}
+	cmd.SilenceUsage = true
+	store, err := openHistory()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	// prefixes as accepted by show
+	for _, uuid := range args {
+		run, err := store.Run(uuid)
+		if err != nil {
+			return err
+		}
+		f.UUIDs = append(f.UUIDs, run.UUID)
+	}
+	uuids, err := store.Delete(f)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput() {
+		if uuids == nil {
+			uuids = []string{}
+		}
+		return printJSON(uuids)
+	}
+	fmt.Printf("Deleted %d run(s)\n", len(uuids))
+	return nil
+}
+
+func shortUUID(uuid string) string {
+	if len(uuid) > 8 {
+		return uuid[:8]
+	}
+	return uuid
+}
+
+func formatRate(v *float64, unit string) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f %s", *v, unit)
+}
+
+// addHistoryFilterFlags registers the flags read by historyFilter
+func addHistoryFilterFlags(c *cobra.Command, since string) {
+	c.Flags().StringP("since", "", since, "Runs at or after this date, time or duration ago, e.g. 2025-06-01 or 7d")
+	c.Flags().StringP("until", "", "", "Runs before this date, time or duration ago")
+	c.Flags().StringP("family", "", "", "Runs with a result of this family: ipv4 or ipv6")
+	c.Flags().StringP("server-name", "", "", "Runs with a result on a server matching this glob pattern")
+	c.Flags().StringP("interface", "", "", "Runs measured with this --interface")
+}
+
+func init() {
+	addHistoryFilterFlags(historyListCmd, "")
+	addHistoryFilterFlags(historyDeleteCmd, "")
+	historyListCmd.Flags().IntP("limit", "", 50, "Maximum number of runs, 0 for all")
+	historyDeleteCmd.Flags().BoolP("all", "", false, "Delete every run")
+
+	historyCmd.AddCommand(historyListCmd, historyShowCmd, historyDeleteCmd)
+	cmd.AddCommand(historyCmd)
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseHistoryTime(t *testing.T) {
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{in: "", want: time.Time{}},
+		{in: "7d", want: time.Date(2025, 6, 3, 12, 0, 0, 0, time.Local)},
+		{in: "0d", want: now},
+		{in: "12h", want: now.Add(-12 * time.Hour)},
+		{in: "90m", want: now.Add(-90 * time.Minute)},
+		{in: "2025-06-01T18:00:00+09:00", want: time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)},
+		{in: "2025-06-01", want: time.Date(2025, 6, 1, 0, 0, 0, 0, time.Local)},
+		{in: "2025-06-01 18:00", want: time.Date(2025, 6, 1, 18, 0, 0, 0, time.Local)},
+		{in: "2025-06-01T18:00", want: time.Date(2025, 6, 1, 18, 0, 0, 0, time.Local)},
+		{in: "1.5d", wantErr: true},
+		{in: "7d12h", wantErr: true},
+		{in: "2025-13-01", wantErr: true},
+		{in: "yesterday", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseHistoryTime(tt.in, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseHistoryTime(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseHistoryTime(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	clientTypes "github.com/inonius/v3cli/api/client"
+	"github.com/spf13/viper"
+)
+
+const influxMeasurement = "inonius_speedtest"
+
+// influxTarget is the InfluxDB v2 HTTP API given by --influx-url
+type influxTarget struct {
+	url    string
+	token  string
+	bucket string
+	org    string
+}
+
+// newInfluxTarget returns nil without --influx-url
+func newInfluxTarget() (*influxTarget, error) {
+	t := &influxTarget{
+		url:    viper.GetString("influx-url"),
+		token:  viper.GetString("influx-token"),
+		bucket: viper.GetString("influx-bucket"),
+		org:    viper.GetString("influx-org"),
+	}
+	if t.url == "" {
+		return nil, nil
+	}
+	if t.bucket == "" || t.org == "" {
+		return nil, fmt.Errorf("'influx-url' requires 'influx-bucket' and 'influx-org'")
+	}
+	if _, err := url.Parse(t.url); err != nil {
+		return nil, fmt.Errorf("invalid 'influx-url': %w", err)
+	}
+	return t, nil
+}
+
+// write posts the lines to /api/v2/write with second precision
+func (t *influxTarget) write(ctx context.Context, lines []string) error {
+	u, err := url.Parse(t.url)
+	if err != nil {
+		return err
+	}
+	u.Path = path.Join(u.Path, "/api/v2/write")
+	q := u.Query()
+	q.Set("org", t.org)
+	q.Set("bucket", t.bucket)
+	q.Set("precision", "s")
+	u.RawQuery = q.Encode()
+
+	body := strings.Join(lines, "\n") + "\n"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewBufferString(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("User-Agent", "inonius_v3cli"+"_"+Version)
+	if t.token != "" {
+		req.Header.Set("Authorization", "Token "+t.token)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("influx write failed: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// influxLines renders every speedtest result as a line, skipped phases are left out of the fields
+func influxLines(result *clientTypes.Result) []string {
+	s := simplifiedResult(*result)
+	orgTag := viper.GetString("orgtag")
+	if result.Session.OrgId != nil {
+		orgTag = *result.Session.OrgId
+	}
+
+	var lines []string
+	for _, r := range s.SpeedtestResult {
+		info := s.IPv4Info
+		if r.SpeedtestType == "IPv6" {
+			info = s.IPv6Info
+		}
+
+		tags := map[string]string{
+			"family":    r.SpeedtestType,
+			"server":    r.Server,
+			"device_id": result.Session.DeviceId,
+			"org_tag":   orgTag,
+		}
+		if info != nil {
+			tags["org"] = info.Org
+		}
+
+		var fields []string
+		if r.Download != nil {
+			fields = append(fields, "download="+formatFloat(*r.Download))
+		}
+		if r.Upload != nil {
+			fields = append(fields, "upload="+formatFloat(*r.Upload))
+		}
+		fields = append(fields, "ping="+formatFloat(r.Ping), "jitter="+formatFloat(r.Jitter))
+		if info != nil && info.Mss != nil {
+			fields = append(fields, "mss="+strconv.Itoa(*info.Mss)+"i")
+		}
+		fields = append(fields, fmt.Sprintf("unit=%q", result.Parameters.Unit))
+
+		lines = append(lines, fmt.Sprintf("%s%s %s %d", influxMeasurement, influxTags(tags), strings.Join(fields, ","), r.UnixTime))
+	}
+	return lines
+}
+
+// influxTags sorts the tags by key as recommended by InfluxDB, empty tags are not allowed
+func influxTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString("," + influxEscape(k) + "=" + influxEscape(tags[k]))
+	}
+	return b.String()
+}
+
+var influxEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", "")
+
+func influxEscape(s string) string {
+	return influxEscaper.Replace(s)
+}
+
+func printInflux(result *clientTypes.Result) error {
+	for _, line := range influxLines(result) {
+		fmt.Println(line)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInfluxLines(t *testing.T) {
+	lines := influxLines(testResult())
+	golden(t, "result.influx", []byte(strings.Join(lines, "\n")+"\n"))
+}
+
+func TestInfluxTags(t *testing.T) {
+	tests := []struct {
+		name string
+		tags map[string]string
+		want string
+	}{
+		{"sorted by key", map[string]string{"server": "a", "family": "IPv4"}, ",family=IPv4,server=a"},
+		{"empty tags left out", map[string]string{"org": "", "family": "IPv6"}, ",family=IPv6"},
+		{"space, comma and equal sign escaped", map[string]string{"org": "AS64500 Example, Inc.", "org_tag": "a=b"}, `,org=AS64500\ Example\,\ Inc.,org_tag=a\=b`},
+		{"newline dropped", map[string]string{"server": "Tokyo\n1"}, ",server=Tokyo1"},
+		{"quotes kept", map[string]string{"server": `"east"`}, `,server="east"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := influxTags(tt.tags); got != tt.want {
+				t.Errorf("influxTags() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInfluxWrite(t *testing.T) {
+	var gotPath, gotQuery, gotAuth, gotBody string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		gotPath, gotQuery, gotAuth, gotBody = r.URL.Path, r.URL.RawQuery, r.Header.Get("Authorization"), string(b)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	target := &influxTarget{url: ts.URL + "/influx", token: "secret", bucket: "speed", org: "home"}
+	if err := target.write(context.Background(), []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != "/influx/api/v2/write" || gotQuery != "bucket=speed&org=home&precision=s" {
+		t.Errorf("wrote to %s?%s", gotPath, gotQuery)
+	}
+	if gotAuth != "Token secret" {
+		t.Errorf("Authorization = %s", gotAuth)
+	}
+	if gotBody != "a\nb\n" {
+		t.Errorf("body = %q", gotBody)
+	}
+}
+
+func TestInfluxWriteError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bucket not found", http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	target := &influxTarget{url: ts.URL, bucket: "speed", org: "home"}
+	err := target.write(context.Background(), []string{"a"})
+	if err == nil || !strings.Contains(err.Error(), "bucket not found") {
+		t.Errorf("write() error = %v, want the response body", err)
+	}
+}
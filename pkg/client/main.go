@@ -3,16 +3,19 @@ package client
 import (
 	"context"
 	"crypto/tls"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
 	clientTypes "github.com/inonius/v3cli/api/client"
+	v3 "github.com/inonius/v3cli/api/v3"
+	"github.com/inonius/v3cli/pkg/history"
 	"github.com/inonius/v3cli/pkg/speedtest"
 	"github.com/librespeed/speedtest-cli/defs"
 	"github.com/spf13/cobra"
@@ -21,36 +24,27 @@ import (
 
 var Version = "0.0.6"
 var configFile string
-var ignoreTlsError bool
 var logger *slog.Logger
 
 var cmd *cobra.Command = &cobra.Command{
-	Use:     "inonius_v3cli",
-	RunE:    fn,
-	Version: Version,
+	Use:               "inonius_v3cli",
+	RunE:              fn,
+	PersistentPreRunE: initConfig,
+	Version:           Version,
 }
 
-func fn(cmd *cobra.Command, args []string) error {
-	logger = slog.Default()
-
-	//Quiet mode
-	isQuiet, _ := cmd.PersistentFlags().GetBool("quiet")
-	isDebug := viper.GetBool("debug")
-	isJson := viper.GetBool("json")
+var runCmd *cobra.Command = &cobra.Command{
+	Use:   "run",
+	Short: "Run the full speedtest (default when no subcommand is given)",
+	RunE:  fn,
+}
 
-	if isJson {
-		isQuiet = true
-	}
-	if isQuiet {
-		slog.SetLogLoggerLevel(slog.LevelError)
-	} else if isDebug {
-		slog.SetLogLoggerLevel(slog.LevelDebug)
-	} else {
-		slog.SetLogLoggerLevel(slog.LevelInfo)
-	}
+// initConfig is shared by every subcommand: log level and config file
+func initConfig(cmd *cobra.Command, args []string) error {
+	logger = slog.Default()
 
 	// config
-	configFile, _ = cmd.PersistentFlags().GetString("config")
+	configFile = viper.GetString("config")
 	if configFile != "" {
 		viper.SetConfigFile(configFile)
 	} else {
@@ -62,8 +56,36 @@ func fn(cmd *cobra.Command, args []string) error {
 		logger.Debug("Config file not found, using default values")
 	}
 
+	if err := validateOutputFormat(outputFormat()); err != nil {
+		return err
+	}
+
+	//Quiet mode, every machine readable output keeps stdout clean
+	isQuiet := outputFormat() != OutputText
+	isDebug := viper.GetBool("debug")
+
+	if isQuiet {
+		slog.SetLogLoggerLevel(slog.LevelError)
+	} else if isDebug {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+	} else {
+		slog.SetLogLoggerLevel(slog.LevelInfo)
+	}
+	return nil
+}
+
+// newClientInstance builds the api client from flags and config
+func newClientInstance() (*clientTypes.Client, error) {
+	return newClientInstanceFor(viper.GetBool("ipv4"), viper.GetBool("ipv6"))
+}
+
+// newClientInstanceFor builds the api client forced to a family regardless of --ipv4 and --ipv6, e.g. for a probe
+func newClientInstanceFor(forceIPv4, forceIPv6 bool) (*clientTypes.Client, error) {
+	isDebug := viper.GetBool("debug")
+	isQuiet := outputFormat() != OutputText
+
 	// ignoreTlsError
-	ignoreTlsError = viper.GetBool("ignore-tls-error")
+	ignoreTlsError := viper.GetBool("ignore-tls-error")
 
 	// orgTag
 	var orgTagptr, freeTagptr *string
@@ -87,10 +109,6 @@ func fn(cmd *cobra.Command, args []string) error {
 		KeepAlive: 30 * time.Second,
 	}
 
-	//IPv4,IPv6 force
-	forceIPv4 := viper.GetBool("ipv4")
-	forceIPv6 := viper.GetBool("ipv6")
-
 	var network string
 	switch {
 	case forceIPv4:
@@ -106,7 +124,7 @@ func fn(cmd *cobra.Command, args []string) error {
 		var err error
 		dialer, err = newDialerAddressBound(src, network)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
@@ -115,7 +133,7 @@ func fn(cmd *cobra.Command, args []string) error {
 		var err error
 		dialer, err = speedtest.NewDialerInterfaceBound(iface)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
@@ -169,39 +187,228 @@ func fn(cmd *cobra.Command, args []string) error {
 			Interface:      viper.GetString("interface"),
 			Source:         viper.GetString("source"),
 			NoICMP:         !viper.GetBool("icmp"), //WEBと同等にしたくデフォルトtrue
-			IPv4:           viper.GetBool("ipv4"),
-			IPv6:           viper.GetBool("ipv6"),
+			IPv4:           forceIPv4,
+			IPv6:           forceIPv6,
 			Debug:          isDebug,
 			Quiet:          isQuiet,
 			IgnoreTLSError: ignoreTlsError,
 			DeviceId:       deviceID,
-			Concurrent:     3,
-			Bytes:          false,
-			MebiBytes:      false,
+			Concurrent:     viper.GetInt("concurrent"),
+			Bytes:          viper.GetBool("bytes"),
+			MebiBytes:      viper.GetBool("mebibytes"),
 			Distance:       "km",
-			Timeout:        2,
-			Chunks:         100,
-			UploadSize:     1024,
-			Duration:       15,
+			Timeout:        viper.GetInt("timeout"),
+			Chunks:         viper.GetInt("chunks"),
+			UploadSize:     viper.GetInt("upload-size"),
+			Duration:       time.Duration(viper.GetInt("duration")),
 			Secure:         false,
-			NoPreAllocate:  false,
+			NoPreAllocate:  viper.GetBool("no-pre-allocate"),
+			NoDownload:     viper.GetBool("no-download") || viper.GetBool("latency-only"),
+			NoUpload:       viper.GetBool("no-upload") || viper.GetBool("latency-only"),
+			Engine:         viper.GetString("engine"),
+			Samples:        viper.GetBool("samples"),
+			NoBufferbloat:  viper.GetBool("no-bufferbloat"),
+			NoQUIC:         viper.GetBool("no-quic"),
+			QUICDuration:   viper.GetDuration("quic-duration"),
+			Warmup:         viper.GetDuration("warmup"),
+			Adaptive:       viper.GetBool("adaptive"),
+			MinDuration:    viper.GetDuration("min-duration"),
+			Tolerance:      viper.GetFloat64("tolerance"),
+			SampleInterval: viper.GetDuration("sample-interval"),
+			List:           viper.GetBool("list"),
+			Server:         viper.GetIntSlice("server"),
+			ExcludeServer:  viper.GetIntSlice("exclude-server"),
+			ServerName:     viper.GetStringSlice("server-name"),
 		},
 		Result: &clientTypes.Result{},
 	}
 
-	if isDebug {
-		//fmt.Println(clientInstance.Config)
+	if clientInstance.Config.Source != "" && clientInstance.Config.Interface != "" {
+		return nil, fmt.Errorf("incompatible options '%s' and '%s'", defs.OptionSource, defs.OptionInterface)
+	}
+	if err := validateConfig(clientInstance.Config); err != nil {
+		return nil, err
 	}
+	return &clientInstance, nil
+}
 
-	if clientInstance.Config.Source != "" && clientInstance.Config.Interface != "" {
-		return fmt.Errorf("incompatible options '%s' and '%s'", defs.OptionSource, defs.OptionInterface)
+// validateConfig checks the ranges of the measurement parameters
+func validateConfig(c *clientTypes.Config) error {
+	for _, v := range []struct {
+		name     string
+		value    int
+		min, max int
+	}{
+		{"concurrent", c.Concurrent, 1, 64},
+		{"duration", int(c.Duration), 1, 300},
+		{"chunks", c.Chunks, 1, 1024},
+		{"upload-size", c.UploadSize, 1, 65536},
+		{"timeout", c.Timeout, 1, 60},
+	} {
+		if v.value < v.min || v.value > v.max {
+			return fmt.Errorf("'%s' must be between %d and %d, got %d", v.name, v.min, v.max, v.value)
+		}
+	}
+	if c.SampleInterval < 50*time.Millisecond || c.SampleInterval > c.Duration*time.Second {
+		return fmt.Errorf("'sample-interval' must be between 50ms and the duration, got %s", c.SampleInterval)
+	}
+	if c.Engine != speedtest.EngineNative && c.Engine != speedtest.EngineLibrespeed {
+		return fmt.Errorf("'engine' must be %s or %s, got %s", speedtest.EngineNative, speedtest.EngineLibrespeed, c.Engine)
+	}
+	if c.Warmup < 0 || c.Warmup >= c.Duration*time.Second {
+		return fmt.Errorf("'warmup' must be shorter than the duration, got %s", c.Warmup)
+	}
+	if c.Warmup > 0 && c.Engine == speedtest.EngineLibrespeed {
+		return fmt.Errorf("'warmup' is not supported by the %s engine", speedtest.EngineLibrespeed)
+	}
+	if !c.NoQUIC && (c.QUICDuration <= 0 || c.QUICDuration > 30*time.Second) {
+		return fmt.Errorf("'quic-duration' must be between 0 and 30s, got %s", c.QUICDuration)
+	}
+	if c.Adaptive {
+		if c.Engine == speedtest.EngineLibrespeed {
+			return fmt.Errorf("'adaptive' is not supported by the %s engine", speedtest.EngineLibrespeed)
+		}
+		if c.MinDuration < c.Warmup || c.MinDuration >= c.Duration*time.Second {
+			return fmt.Errorf("'min-duration' must be between the warmup and the duration, got %s", c.MinDuration)
+		}
+		if c.Tolerance <= 0 || c.Tolerance >= 1 {
+			return fmt.Errorf("'tolerance' must be between 0 and 1, got %g", c.Tolerance)
+		}
+	}
+	return nil
+}
+
+// speedtestParameters echoes the measurement settings into the result
+func speedtestParameters(c *clientTypes.Config) clientTypes.SpeedtestParameters {
+	p := clientTypes.SpeedtestParameters{
+		Concurrent:     c.Concurrent,
+		Duration:       int(c.Duration),
+		Warmup:         c.Warmup.Seconds(),
+		Adaptive:       c.Adaptive,
+		Chunks:         c.Chunks,
+		UploadSize:     c.UploadSize,
+		Timeout:        c.Timeout,
+		NoPreAllocate:  c.NoPreAllocate,
+		NoDownload:     c.NoDownload,
+		NoUpload:       c.NoUpload,
+		Engine:         c.Engine,
+		Bufferbloat:    !c.NoBufferbloat,
+		QUIC:           !c.NoQUIC,
+		Samples:        c.Samples,
+		SampleInterval: c.SampleInterval.Seconds(),
+		Unit:           speedtest.Unit(*c),
+	}
+	if c.Adaptive {
+		p.MinDuration = c.MinDuration.Seconds()
+		p.Tolerance = c.Tolerance
+	}
+	return p
+}
+
+func fn(cmd *cobra.Command, args []string) error {
+	clientInstance, err := newClientInstance()
+	if err != nil {
+		return err
+	}
+
+	if clientInstance.Config.List {
+		return serversFn(cmd, args)
 	}
+	outputs, err := newRunOutputs()
+	if err != nil {
+		return err
+	}
+	defer outputs.Close()
+
+	// from here on errors are not about the flags
+	cmd.SilenceUsage = true
 
 	logger.Info("Starting iNonius client")
-	speedtestClient := NewSpeedtestClient(&clientInstance)
+	if err := runOnce(context.Background(), clientInstance, outputs); err != nil {
+		if errors.Is(err, errNoSession) {
+			return nil
+		}
+		return err
+	}
+	logger.Info("Thank you for using inonius_v3cli")
+	return nil
+}
+
+// errNoSession is returned by runOnce when the run stopped before a session was registered, the reason is logged
+var errNoSession = errors.New("no speedtest session was registered")
+
+// errNoResult is returned by runOnce when the speedtest failed on every family, the reason is logged
+var errNoResult = errors.New("no speedtest result")
+
+func hasResults(result *clientTypes.Result) bool {
+	return len(result.SpeedtestResultPair.IPv4Results)+len(result.SpeedtestResultPair.IPv6Results) > 0
+}
+
+// runOutputs are where a run is written besides stdout
+type runOutputs struct {
+	influx *influxTarget
+	store  *history.Store
+}
+
+func newRunOutputs() (*runOutputs, error) {
+	influx, err := newInfluxTarget()
+	if err != nil {
+		return nil, err
+	}
+	store, err := newHistoryStore()
+	if err != nil {
+		return nil, err
+	}
+	return &runOutputs{influx: influx, store: store}, nil
+}
+
+func (o *runOutputs) Close() {
+	if o.store != nil {
+		o.store.Close()
+	}
+}
+
+// runOnce measures with clientInstance and writes the result to stdout in the --output format and to the outputs
+func runOnce(ctx context.Context, clientInstance *clientTypes.Client, outputs *runOutputs) error {
+	speedtestClient := NewSpeedtestClient(clientInstance)
+	if err := measure(ctx, speedtestClient); err != nil {
+		return err
+	}
+	if clientInstance.Result.Session.UUID == "" {
+		return errNoSession
+	}
+	// stopped, the session is finished with what was measured but the result is incomplete
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !hasResults(clientInstance.Result) {
+		return errNoResult
+	}
+
+	if err := printResult(clientInstance.Result); err != nil {
+		return err
+	}
+	if outputs.influx != nil {
+		if err := outputs.influx.write(ctx, influxLines(clientInstance.Result)); err != nil {
+			return err
+		}
+		logger.Info("Result written to InfluxDB", "bucket", outputs.influx.bucket)
+	}
+	if outputs.store != nil {
+		if err := saveHistory(outputs.store, clientInstance); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// measure runs the whole flow: client info, session, access type, speedtest, QUIC and finish
+func measure(ctx context.Context, speedtestClient *SpeedtestClient) error {
+	clientInstance := speedtestClient.v3Client
+
+	clientInstance.Result.Parameters = speedtestParameters(clientInstance.Config)
 
 	// 1. Get client info
-	ctx := context.Background()
 	clientInstance.Result.ClientInfoPair = clientTypes.ClientInfoPair{}
 
 	v4info, err := speedtestClient.GetClientInfo(ctx, true)
@@ -236,12 +443,22 @@ func fn(cmd *cobra.Command, args []string) error {
 		logger.Error("failed to register session", "error", err)
 		return nil
 	}
+	// 6. Finish on return, also on an error or when ctx was cancelled, so that a failed or stopped run does not leave the session open
+	defer func() {
+		finishCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		defer cancel()
+		if err := speedtestClient.FinishSpeedtestSession(finishCtx); err != nil {
+			logger.Error("failed to finish session", "error", err)
+		}
+		logger.Debug("Complete!", "SpeedtestSessionID", clientInstance.Result.Session.UUID)
+	}()
 
 	// 3. Register AccessType Session
 	var ipv4Mss int
 	var ipv6Mss int
+	var ipv4MssResp, ipv6MssResp v3.MSSResponse
 	if clientInstance.Result.IPv4Available {
-		ipv4MssResp, err := speedtestClient.GetMSS(ctx, true)
+		ipv4MssResp, err = speedtestClient.GetMSS(ctx, true)
 		if err != nil {
 			logger.Error("abort", "error", err)
 			return err
@@ -249,17 +466,26 @@ func fn(cmd *cobra.Command, args []string) error {
 		ipv4Mss = ipv4MssResp.Mss
 	}
 	if clientInstance.Result.IPv6Available {
-		ipv6MssResp, err := speedtestClient.GetMSS(ctx, false)
+		ipv6MssResp, err = speedtestClient.GetMSS(ctx, false)
 		if err != nil {
 			logger.Error("abort", "error", err)
 			return err
 		}
 		ipv6Mss = ipv6MssResp.Mss
 	}
+	classifier := newClassifier()
+	clientInstance.Result.AccessTypeGuess = clientTypes.AccessTypeGuessPair{}
+	if clientInstance.Result.IPv4Available {
+		clientInstance.Result.AccessTypeGuess.IPv4 = classifier.Classify(true, ipv4MssResp)
+	}
+	if clientInstance.Result.IPv6Available {
+		clientInstance.Result.AccessTypeGuess.IPv6 = classifier.Classify(false, ipv6MssResp)
+	}
 	if err := speedtestClient.RegisterAccessTypeSession(ctx, &ipv4Mss, &ipv6Mss); err != nil {
 		logger.Error("failed to register ats", "error", err)
 		return err
 	}
+	logAccessType(clientInstance.Result)
 
 	var ipv4server, ipv6server []defs.Server
 
@@ -270,6 +496,28 @@ func fn(cmd *cobra.Command, args []string) error {
 	} else {
 		ipv4server, ipv6server = ConvertLibrespeedServersToDefsServers(server.Librespeed)
 	}
+	if err := checkPins(clientInstance.Config, append(slices.Clone(ipv4server), ipv6server...)); err != nil {
+		logger.Error("abort", "error", err)
+		return err
+	}
+
+	// compare the api MSS with the MSS oneshot servers, the api MSS is kept even without any
+	clientInstance.Result.MSSResults = nil
+	mssServers := OneshotServers(server.Oneshot, v3.OneshotTestServerTypeMSS)
+	if clientInstance.Result.IPv4Available {
+		r := probeMSS(ctx, speedtestClient, classifier, true, &ipv4MssResp, nil, mssServers)
+		if len(mssServers) > 0 {
+			logMSS(r)
+		}
+		clientInstance.Result.MSSResults = append(clientInstance.Result.MSSResults, r)
+	}
+	if clientInstance.Result.IPv6Available {
+		r := probeMSS(ctx, speedtestClient, classifier, false, &ipv6MssResp, nil, mssServers)
+		if len(mssServers) > 0 {
+			logMSS(r)
+		}
+		clientInstance.Result.MSSResults = append(clientInstance.Result.MSSResults, r)
+	}
 
 	// 4. Speedtest
 	clientInstance.Result.SpeedtestResultPair = clientTypes.SpeedtestResultPair{}
@@ -280,11 +528,12 @@ func fn(cmd *cobra.Command, args []string) error {
 		if clientInstance.Result.IPv6Available {
 
 			logger.Info("=====Starting IPv6 Speedtest...=====")
-			result, err := speedtest.Speedtest(clientInstance, ctx, logger, ipv6server)
+			results, err := speedtest.Speedtest(*clientInstance, ctx, logger, ipv6server)
 			if err != nil {
 				logger.Error("IPv6 Speedtest failed", "error", err)
 			} else {
-				clientInstance.Result.SpeedtestResultPair.IPv6Result = result
+				clientInstance.Result.SpeedtestResultPair.IPv6Result = results[0]
+				clientInstance.Result.SpeedtestResultPair.IPv6Results = results
 			}
 		} else {
 			clientInstance.Result.SpeedtestResultPair.IPv6Result = nil
@@ -292,14 +541,15 @@ func fn(cmd *cobra.Command, args []string) error {
 
 		//IPv4
 		if clientInstance.Result.IPv4Available {
-			time.Sleep(3 * time.Second)
+			pause(ctx, 3*time.Second)
 
 			logger.Info("=====Starting IPv4 Speedtest...=====")
-			result, err := speedtest.Speedtest(clientInstance, ctx, logger, ipv4server)
+			results, err := speedtest.Speedtest(*clientInstance, ctx, logger, ipv4server)
 			if err != nil {
 				logger.Error("IPv4 Speedtest failed", "error", err)
 			} else {
-				clientInstance.Result.SpeedtestResultPair.IPv4Result = result
+				clientInstance.Result.SpeedtestResultPair.IPv4Result = results[0]
+				clientInstance.Result.SpeedtestResultPair.IPv4Results = results
 			}
 		} else {
 			clientInstance.Result.SpeedtestResultPair.IPv4Result = nil
@@ -309,60 +559,68 @@ func fn(cmd *cobra.Command, args []string) error {
 		//IPv4
 		if clientInstance.Result.IPv4Available {
 			logger.Info("=====Starting IPv4 Speedtest...=====")
-			result, err := speedtest.Speedtest(clientInstance, ctx, logger, ipv4server)
+			results, err := speedtest.Speedtest(*clientInstance, ctx, logger, ipv4server)
 			if err != nil {
 				logger.Error("IPv4 Speedtest failed", "error", err)
 			} else {
-				clientInstance.Result.SpeedtestResultPair.IPv4Result = result
+				clientInstance.Result.SpeedtestResultPair.IPv4Result = results[0]
+				clientInstance.Result.SpeedtestResultPair.IPv4Results = results
 			}
 		} else {
 			clientInstance.Result.SpeedtestResultPair.IPv4Result = nil
 		}
 
-		time.Sleep(3 * time.Second)
+		pause(ctx, 3*time.Second)
 
 		//IPv6
 		if clientInstance.Result.IPv6Available {
 
 			logger.Info("=====Starting IPv6 Speedtest...=====")
-			result, err := speedtest.Speedtest(clientInstance, ctx, logger, ipv6server)
+			results, err := speedtest.Speedtest(*clientInstance, ctx, logger, ipv6server)
 			if err != nil {
 				logger.Error("IPv6 Speedtest failed", "error", err)
 			} else {
-				clientInstance.Result.SpeedtestResultPair.IPv6Result = result
+				clientInstance.Result.SpeedtestResultPair.IPv6Result = results[0]
+				clientInstance.Result.SpeedtestResultPair.IPv6Results = results
 			}
 		} else {
 			clientInstance.Result.SpeedtestResultPair.IPv6Result = nil
 		}
 	}
-	// 5. Finish
-	err = speedtestClient.FinishSpeedtestSession(ctx)
-	if err != nil {
-		logger.Error("failed to finish session", "error", err)
+	// 5. QUIC oneshot
+	if !clientInstance.Config.NoQUIC {
+		clientInstance.Result.QUICResults = quicProbe(ctx, clientInstance, OneshotServers(server.Oneshot, v3.OneshotTestServerTypeQUIC))
 	}
+	return nil
+}
 
-	logger.Debug("Complete!", "SpeedtestSessionID", clientInstance.Result.Session.UUID)
-	if isDebug {
-		//fmt.Println(clientInstance.Result)
+// checkPins warns about the --server ids and --server-name patterns matching no server,
+// a family without any pinned server selects the fastest one, so nothing pinned at all is an error
+func checkPins(c *clientTypes.Config, servers []defs.Server) error {
+	if len(c.Server) == 0 && len(c.ServerName) == 0 {
+		return nil
 	}
-
-	if isQuiet {
-		if isJson {
-			j, _ := json.Marshal(simplifiedResult(*clientInstance.Result))
-			fmt.Println(string(j))
-		} else {
-			if clientInstance.Result.IPv4Available {
-				fmt.Println("IPv4Address", clientInstance.Result.ClientInfoPair.IPv4Info.IP.String(), "IPv4mss", *clientInstance.Result.AccessTypeSession.IPv4Mss, "IPv4Upload", clientInstance.Result.SpeedtestResultPair.IPv4Result.Upload, "Mbps", "IPv4Download", clientInstance.Result.SpeedtestResultPair.IPv4Result.Download, "Mbps", "IPv4RTT", fmt.Sprintf("%.2f", clientInstance.Result.SpeedtestResultPair.IPv4Result.Ping), "ms", "IPv4Jitter", clientInstance.Result.SpeedtestResultPair.IPv4Result.Jitter, "ms")
-			}
-			if clientInstance.Result.IPv6Available {
-				fmt.Println("IPv6Address", string(clientInstance.Result.ClientInfoPair.IPv6Info.IP.String()), "IPv6mss", *clientInstance.Result.AccessTypeSession.IPv6Mss, "IPv6Upload", clientInstance.Result.SpeedtestResultPair.IPv6Result.Upload, "Mbps", "IPv6Download", clientInstance.Result.SpeedtestResultPair.IPv6Result.Download, "Mbps", "IPv6RTT", fmt.Sprintf("%.2f", clientInstance.Result.SpeedtestResultPair.IPv6Result.Ping), "ms", "IPv6Jitter", clientInstance.Result.SpeedtestResultPair.IPv6Result.Jitter, "ms")
-			}
-		}
+	ids, names := speedtest.UnmatchedPins(servers, c.Server, c.ServerName)
+	for _, id := range ids {
+		logger.Warn("No server with this ID, see: servers", "server", id)
+	}
+	for _, pattern := range names {
+		logger.Warn("No server matching this name, see: servers", "server-name", pattern)
+	}
+	if len(ids) == len(c.Server) && len(names) == len(c.ServerName) {
+		return fmt.Errorf("none of the pinned servers exists")
 	}
-	logger.Info("Thank you for using inonius_v3cli")
 	return nil
 }
 
+// pause waits between the families, or until ctx is cancelled
+func pause(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
 func NewCommand() *cobra.Command {
 	return cmd
 }
@@ -380,7 +638,19 @@ func init() {
 	cmd.PersistentFlags().BoolP("help", "?", false, "Show help")
 	cmd.PersistentFlags().BoolP("debug", "d", false, "Debug mode")
 	cmd.PersistentFlags().BoolP("quiet", "q", false, "Quiet mode")
-	cmd.PersistentFlags().BoolP("json", "", false, "Json mode")
+	cmd.PersistentFlags().BoolP("json", "", false, "Output as JSON")
+	cmd.PersistentFlags().BoolP("json-full", "", false, "Output the complete result as JSON, same as --output json:full")
+	cmd.PersistentFlags().StringP("output", "o", "", "Output format: text, quiet, json, json:full, csv, tsv, prometheus, influx (line protocol) or template")
+	cmd.PersistentFlags().StringP("format", "", "", "Render the result with a Go text/template, e.g. '{{.IPv4.Download}} {{.IPv4.Upload}}'")
+	cmd.PersistentFlags().StringP("template-file", "", "", "Render the result with the Go text/template in this file")
+	cmd.PersistentFlags().BoolP("no-header", "", false, "Omit the header line of the csv and tsv output, e.g. to append to a file")
+	cmd.PersistentFlags().StringP("influx-url", "", "", "Also write the result to this InfluxDB v2 HTTP API, e.g. http://localhost:8086")
+	cmd.PersistentFlags().StringP("influx-token", "", "", "API token of --influx-url")
+	cmd.PersistentFlags().StringP("influx-bucket", "", "", "Bucket of --influx-url")
+	cmd.PersistentFlags().StringP("influx-org", "", "", "Organization of --influx-url")
+	cmd.PersistentFlags().StringP("prometheus-file", "", "", "Write the prometheus output atomically to this file instead of stdout, e.g. for the node_exporter textfile collector")
+	cmd.PersistentFlags().BoolP("history", "", false, "Save the result to the local history database (see: history)")
+	cmd.PersistentFlags().StringP("history-db", "", "", "Path of the history database (default: inonius_v3cli/history.db in the user config directory)")
 	cmd.PersistentFlags().BoolP("ignore-tls-error", "k", false, "Ignore tls error")
 	cmd.PersistentFlags().StringP("config", "c", "", "--config <CONFIG_PATH> YML, TOML and JSON are available. (default ./config.yml)")
 	cmd.PersistentFlags().StringP("orgtag", "O", "", "OrgTag if you have")
@@ -395,13 +665,53 @@ func init() {
 	cmd.PersistentFlags().StringP("ipv4-endpoint", "", "https://ipv4-api.inonius.net", "Use: client --ipv4-endpoint <ENDPOINT>")
 	cmd.PersistentFlags().StringP("ipv6-endpoint", "", "https://ipv6-api.inonius.net", "Use: client --ipv4-endpoint <ENDPOINT>")
 
+	cmd.PersistentFlags().IntSliceP("server", "", nil, "Server ID to test against, repeatable. Every given server is tested (see: servers)")
+	cmd.PersistentFlags().IntSliceP("exclude-server", "", nil, "Server ID to exclude from the selection, repeatable")
+	cmd.PersistentFlags().StringSliceP("server-name", "", nil, "Server name glob pattern to test against, repeatable (e.g. 'ipv6-librespeed*')")
+	cmd.PersistentFlags().IntP("concurrent", "", 3, "Number of concurrent HTTP streams per direction")
+	cmd.PersistentFlags().IntP("duration", "", 15, "Duration of each download and upload test in seconds")
+	cmd.PersistentFlags().DurationP("warmup", "", 0, "Grace period at the start of each download and upload excluded from the throughput (TCP slow-start), e.g. 2s")
+	cmd.PersistentFlags().BoolP("adaptive", "", false, "Stop each download and upload once the throughput is stable, --duration becomes the maximum")
+	cmd.PersistentFlags().DurationP("min-duration", "", 5*time.Second, "Minimum duration of each download and upload in adaptive mode")
+	cmd.PersistentFlags().Float64P("tolerance", "", 0.05, "Relative variation of the rolling throughput considered stable in adaptive mode")
+	cmd.PersistentFlags().IntP("chunks", "", 100, "Chunks of 1MiB to download per request")
+	cmd.PersistentFlags().IntP("upload-size", "", 1024, "Size of each upload payload in KiB")
+	cmd.PersistentFlags().IntP("timeout", "", 2, "HTTP response timeout of the test servers in seconds")
+	cmd.PersistentFlags().BoolP("no-pre-allocate", "", false, "Do not pre-allocate the upload payload in memory (lower performance, less memory)")
+	cmd.PersistentFlags().BoolP("bytes", "", false, "Report throughput in bytes per second instead of bits")
+	cmd.PersistentFlags().BoolP("mebibytes", "", false, "Use 1024 based units instead of 1000")
+	cmd.PersistentFlags().StringP("engine", "", speedtest.EngineNative, "Measurement engine: native or librespeed")
+	cmd.PersistentFlags().BoolP("samples", "", false, "Include the per-interval throughput samples and their statistics in the JSON output (native engine)")
+	cmd.PersistentFlags().DurationP("sample-interval", "", time.Second, "Interval of the throughput samples, e.g. 100ms")
+	cmd.PersistentFlags().BoolP("no-bufferbloat", "", false, "Do not measure the latency under load (bufferbloat) during download and upload")
+	cmd.PersistentFlags().BoolP("no-quic", "", false, "Do not run the QUIC/HTTP3 oneshot test")
+	cmd.PersistentFlags().DurationP("quic-duration", "", 2*time.Second, "Duration of the QUIC/HTTP3 and the TCP reference throughput sample")
+	cmd.PersistentFlags().BoolP("no-download", "", false, "Skip the download test")
+	cmd.PersistentFlags().BoolP("no-upload", "", false, "Skip the upload test")
+	cmd.PersistentFlags().BoolP("latency-only", "", false, "Only measure RTT and jitter (same as --no-download --no-upload)")
+	cmd.Flags().BoolP("list", "", false, "List the speedtest servers (same as the servers command)")
+
 	// Hidden flags
 	cmd.PersistentFlags().Lookup("freetag").Hidden = true
 
+	cmd.AddCommand(runCmd)
+
 	// Bind debug flag to viper
 	viper.BindPFlag("debug", cmd.PersistentFlags().Lookup("debug"))
 	viper.BindPFlag("quiet", cmd.PersistentFlags().Lookup("quiet"))
 	viper.BindPFlag("json", cmd.PersistentFlags().Lookup("json"))
+	viper.BindPFlag("json-full", cmd.PersistentFlags().Lookup("json-full"))
+	viper.BindPFlag("output", cmd.PersistentFlags().Lookup("output"))
+	viper.BindPFlag("format", cmd.PersistentFlags().Lookup("format"))
+	viper.BindPFlag("template-file", cmd.PersistentFlags().Lookup("template-file"))
+	viper.BindPFlag("no-header", cmd.PersistentFlags().Lookup("no-header"))
+	viper.BindPFlag("prometheus-file", cmd.PersistentFlags().Lookup("prometheus-file"))
+	viper.BindPFlag("influx-url", cmd.PersistentFlags().Lookup("influx-url"))
+	viper.BindPFlag("influx-token", cmd.PersistentFlags().Lookup("influx-token"))
+	viper.BindPFlag("influx-bucket", cmd.PersistentFlags().Lookup("influx-bucket"))
+	viper.BindPFlag("influx-org", cmd.PersistentFlags().Lookup("influx-org"))
+	viper.BindPFlag("history", cmd.PersistentFlags().Lookup("history"))
+	viper.BindPFlag("history-db", cmd.PersistentFlags().Lookup("history-db"))
 	viper.BindPFlag("ignore-tls-error", cmd.PersistentFlags().Lookup("ignore-tls-error"))
 	viper.BindPFlag("config", cmd.PersistentFlags().Lookup("config"))
 	viper.BindPFlag("orgtag", cmd.PersistentFlags().Lookup("orgtag"))
@@ -415,6 +725,36 @@ func init() {
 	viper.BindPFlag("endpoint", cmd.PersistentFlags().Lookup("endpoint"))
 	viper.BindPFlag("ipv4-endpoint", cmd.PersistentFlags().Lookup("ipv4-endpoint"))
 	viper.BindPFlag("ipv6-endpoint", cmd.PersistentFlags().Lookup("ipv6-endpoint"))
+	viper.BindPFlag("list", cmd.Flags().Lookup("list"))
+	viper.BindPFlag("server", cmd.PersistentFlags().Lookup("server"))
+	viper.BindPFlag("exclude-server", cmd.PersistentFlags().Lookup("exclude-server"))
+	viper.BindPFlag("server-name", cmd.PersistentFlags().Lookup("server-name"))
+	viper.BindPFlag("concurrent", cmd.PersistentFlags().Lookup("concurrent"))
+	viper.BindPFlag("duration", cmd.PersistentFlags().Lookup("duration"))
+	viper.BindPFlag("warmup", cmd.PersistentFlags().Lookup("warmup"))
+	viper.BindPFlag("adaptive", cmd.PersistentFlags().Lookup("adaptive"))
+	viper.BindPFlag("min-duration", cmd.PersistentFlags().Lookup("min-duration"))
+	viper.BindPFlag("tolerance", cmd.PersistentFlags().Lookup("tolerance"))
+	viper.BindPFlag("chunks", cmd.PersistentFlags().Lookup("chunks"))
+	viper.BindPFlag("upload-size", cmd.PersistentFlags().Lookup("upload-size"))
+	viper.BindPFlag("timeout", cmd.PersistentFlags().Lookup("timeout"))
+	viper.BindPFlag("no-pre-allocate", cmd.PersistentFlags().Lookup("no-pre-allocate"))
+	viper.BindPFlag("bytes", cmd.PersistentFlags().Lookup("bytes"))
+	viper.BindPFlag("mebibytes", cmd.PersistentFlags().Lookup("mebibytes"))
+	viper.BindPFlag("engine", cmd.PersistentFlags().Lookup("engine"))
+	viper.BindPFlag("samples", cmd.PersistentFlags().Lookup("samples"))
+	viper.BindPFlag("sample-interval", cmd.PersistentFlags().Lookup("sample-interval"))
+	viper.BindPFlag("no-bufferbloat", cmd.PersistentFlags().Lookup("no-bufferbloat"))
+	viper.BindPFlag("no-quic", cmd.PersistentFlags().Lookup("no-quic"))
+	viper.BindPFlag("quic-duration", cmd.PersistentFlags().Lookup("quic-duration"))
+	viper.BindPFlag("no-download", cmd.PersistentFlags().Lookup("no-download"))
+	viper.BindPFlag("no-upload", cmd.PersistentFlags().Lookup("no-upload"))
+	viper.BindPFlag("latency-only", cmd.PersistentFlags().Lookup("latency-only"))
+
+	// Environment variables: INONIUS_DURATION, INONIUS_UPLOAD_SIZE, ...
+	viper.SetEnvPrefix("inonius")
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	viper.AutomaticEnv()
 }
 
 func newDialerAddressBound(src string, network string) (dialer *net.Dialer, err error) {
@@ -0,0 +1,160 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	clientTypes "github.com/inonius/v3cli/api/client"
+	v3 "github.com/inonius/v3cli/api/v3"
+	"github.com/inonius/v3cli/pkg/accesstype"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var mssCmd *cobra.Command = &cobra.Command{
+	Use:   "mss",
+	Short: "Measure the TCP MSS towards the api endpoints and the MSS oneshot servers",
+	Args:  cobra.NoArgs,
+	RunE:  mssFn,
+}
+
+func mssFn(cmd *cobra.Command, args []string) error {
+	clientInstance, err := newClientInstance()
+	if err != nil {
+		return err
+	}
+	speedtestClient := NewSpeedtestClient(clientInstance)
+	ctx := context.Background()
+
+	var servers []v3.OneshotTestServer
+	if tsl, err := speedtestClient.GetServers(ctx); err != nil {
+		logger.Warn("failed to get the MSS oneshot servers", "error", err)
+	} else {
+		servers = OneshotServers(tsl.Oneshot, v3.OneshotTestServerTypeMSS)
+	}
+
+	classifier := newClassifier()
+	var results []*clientTypes.MSSResult
+	for _, isIPv4 := range targetFamilies() {
+		var api *v3.MSSResponse
+		mr, err := speedtestClient.GetMSS(ctx, isIPv4)
+		if err != nil {
+			logger.Debug("failed to get mss", "family", familyName(isIPv4), "error", err.Error())
+		} else {
+			api = &mr
+		}
+		results = append(results, probeMSS(ctx, speedtestClient, classifier, isIPv4, api, err, servers))
+	}
+
+	if jsonOutput() {
+		return printJSON(results)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FAMILY\tENDPOINT\tMSS\tACTUAL MSS\tESTIMATED MTU\tLOCAL GUESS")
+	for _, r := range results {
+		for _, s := range r.Servers {
+			if s.Error != "" {
+				fmt.Fprintf(w, "%s\t%s\t%s\t\t\t\n", r.Family, s.Endpoint, "not available")
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\n", r.Family, s.Endpoint, s.Mss, s.ActualMss, s.EstimatedMtu, guessString(s.Guess))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for _, r := range results {
+		if r.Disagree {
+			fmt.Printf("%s: the MSS differs by destination\n", r.Family)
+		}
+	}
+	return nil
+}
+
+// probeMSS queries every MSS oneshot server on the family and compares them to the api /mss (api, apiErr)
+func probeMSS(ctx context.Context, speedtestClient *SpeedtestClient, classifier *accesstype.Classifier, isIPv4 bool, api *v3.MSSResponse, apiErr error, servers []v3.OneshotTestServer) *clientTypes.MSSResult {
+	endpoint := speedtestClient.v3Client.Config.IPv6Endpoint
+	if isIPv4 {
+		endpoint = speedtestClient.v3Client.Config.IPv4Endpoint
+	}
+	r := &clientTypes.MSSResult{
+		Family:  familyName(isIPv4),
+		Servers: []*clientTypes.MSSServerResult{mssServerResult(classifier, isIPv4, endpoint, api, apiErr)},
+	}
+
+	for _, server := range servers {
+		mr, err := speedtestClient.GetOneshotMSS(ctx, server.HTTPEndpoint, isIPv4)
+		if err != nil {
+			logger.Debug("failed to get mss", "family", r.Family, "endpoint", server.HTTPEndpoint, "error", err.Error())
+			r.Servers = append(r.Servers, mssServerResult(classifier, isIPv4, server.HTTPEndpoint, nil, err))
+			continue
+		}
+		r.Servers = append(r.Servers, mssServerResult(classifier, isIPv4, server.HTTPEndpoint, &mr, nil))
+	}
+
+	mss := -1
+	for _, s := range r.Servers {
+		if s.Error != "" {
+			continue
+		}
+		if mss >= 0 && s.Mss != mss {
+			r.Disagree = true
+		}
+		mss = s.Mss
+	}
+	return r
+}
+
+func mssServerResult(classifier *accesstype.Classifier, isIPv4 bool, endpoint string, mr *v3.MSSResponse, err error) *clientTypes.MSSServerResult {
+	if mr == nil {
+		if err == nil {
+			err = fmt.Errorf("not available")
+		}
+		return &clientTypes.MSSServerResult{Endpoint: endpoint, Error: err.Error()}
+	}
+	return &clientTypes.MSSServerResult{
+		Endpoint:     endpoint,
+		Mss:          mr.Mss,
+		ActualMss:    mr.ActualMss,
+		EstimatedMtu: mr.EstinamtedMtu,
+		Guess:        classifier.Classify(isIPv4, *mr),
+	}
+}
+
+// newClassifier extends the default access type rules with `accesstype-rules` of the config file
+func newClassifier() *accesstype.Classifier {
+	var extra []accesstype.Rule
+	if err := viper.UnmarshalKey("accesstype-rules", &extra); err != nil {
+		logger.Warn("ignoring invalid accesstype-rules", "error", err)
+		extra = nil
+	}
+	return accesstype.NewClassifier(extra)
+}
+
+func guessString(g *clientTypes.AccessTypeGuess) string {
+	if g == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s (%.0f%%)", g.Name, g.Confidence*100)
+}
+
+// logMSS logs the per-server MSS and warns when they disagree
+func logMSS(r *clientTypes.MSSResult) {
+	for _, s := range r.Servers {
+		if s.Error != "" {
+			logger.Info(fmt.Sprintf("%s MSS from %s not available", r.Family, s.Endpoint), "error", s.Error)
+			continue
+		}
+		logger.Info(fmt.Sprintf("%s MSS from %s: %d (actual %d, estimated MTU %d, local guess %s)", r.Family, s.Endpoint, s.Mss, s.ActualMss, s.EstimatedMtu, guessString(s.Guess)))
+	}
+	if r.Disagree {
+		logger.Warn(fmt.Sprintf("%s MSS differs by destination, a tunnel may apply to some paths only", r.Family))
+	}
+}
+
+func init() {
+	cmd.AddCommand(mssCmd)
+}
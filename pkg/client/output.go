@@ -0,0 +1,129 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	clientTypes "github.com/inonius/v3cli/api/client"
+	v3 "github.com/inonius/v3cli/api/v3"
+	"github.com/inonius/v3cli/pkg/accesstype"
+	"github.com/spf13/viper"
+)
+
+const (
+	OutputText     = "text"
+	OutputQuiet    = "quiet"
+	OutputJSON     = "json"
+	OutputJSONFull = "json:full"
+	OutputCSV      = "csv"
+	OutputTSV      = "tsv"
+	OutputProm     = "prometheus"
+	OutputInflux   = "influx"
+)
+
+// outputFormats are the values of --output, text leaves the result in the log only
+var outputFormats = map[string]func(result *clientTypes.Result) error{
+	OutputText:     func(*clientTypes.Result) error { return nil },
+	OutputQuiet:    printQuiet,
+	OutputJSON:     func(result *clientTypes.Result) error { return printJSON(simplifiedResult(*result)) },
+	OutputJSONFull: func(result *clientTypes.Result) error { return printJSON(fullResult(result)) },
+	OutputCSV:      func(result *clientTypes.Result) error { return printDelimited(result, ',') },
+	OutputTSV:      func(result *clientTypes.Result) error { return printDelimited(result, '\t') },
+	OutputProm:     printPrometheus,
+	OutputInflux:   printInflux,
+	OutputTemplate: printTemplate,
+}
+
+// outputFormat resolves --output, --format/--template-file, --json-full, --json and --quiet in this order
+func outputFormat() string {
+	switch {
+	case viper.GetString("output") != "":
+		return viper.GetString("output")
+	case viper.GetString("format") != "" || viper.GetString("template-file") != "":
+		return OutputTemplate
+	case viper.GetBool("json-full"):
+		return OutputJSONFull
+	case viper.GetBool("json"):
+		return OutputJSON
+	case viper.GetBool("quiet"):
+		return OutputQuiet
+	default:
+		return OutputText
+	}
+}
+
+// jsonOutput is used by the subcommands, which only have a single JSON form
+func jsonOutput() bool {
+	return strings.HasPrefix(outputFormat(), OutputJSON)
+}
+
+func validateOutputFormat(format string) error {
+	if _, ok := outputFormats[format]; !ok {
+		return fmt.Errorf("unknown output format %q, available: %s", format, strings.Join(outputFormatNames(), ", "))
+	}
+	// fail before measuring rather than after
+	if format == OutputTemplate {
+		_, err := resultTemplate("")
+		return err
+	}
+	return nil
+}
+
+func outputFormatNames() []string {
+	names := make([]string, 0, len(outputFormats))
+	for name := range outputFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// printResult writes the result of a run to stdout in the --output format
+func printResult(result *clientTypes.Result) error {
+	return outputFormats[outputFormat()](result)
+}
+
+// fullResult wraps the complete result with the schema version
+func fullResult(result *clientTypes.Result) clientTypes.FullResult {
+	return clientTypes.FullResult{
+		SchemaVersion: clientTypes.FullResultSchemaVersion,
+		ClientVersion: Version,
+		Result:        result,
+	}
+}
+
+// logAccessType shows the access type detected by the api next to the local guess
+func logAccessType(result *clientTypes.Result) {
+	ats := result.AccessTypeSession
+	for _, family := range []struct {
+		name  string
+		ct    *v3.ConnectionType
+		guess *clientTypes.AccessTypeGuess
+	}{{"IPv4", ats.IPv4ConnectionType, result.AccessTypeGuess.IPv4}, {"IPv6", ats.IPv6ConnectionType, result.AccessTypeGuess.IPv6}} {
+		if family.ct != nil {
+			logger.Info(fmt.Sprintf("%s access type: %s (MSS %d)", family.name, family.ct.Name, family.ct.Mss))
+		}
+		if family.guess == nil {
+			continue
+		}
+		logger.Info(fmt.Sprintf("%s local guess: %s (MTU %d)", family.name, guessString(family.guess), family.guess.Mtu))
+		if family.ct != nil && family.guess.Name != accesstype.Unknown && !strings.EqualFold(family.ct.Name, family.guess.Name) {
+			logger.Warn(fmt.Sprintf("%s local guess differs from the api", family.name), "api", family.ct.Name, "local", family.guess.Name)
+		}
+	}
+	if ats.Flets != nil {
+		logger.Info(fmt.Sprintf("FLET'S region: %s", *ats.Flets))
+	}
+}
+
+// printJSON is used by the subcommands for --json
+func printJSON(v interface{}) error {
+	j, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(j))
+	return nil
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"flag"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	clientTypes "github.com/inonius/v3cli/api/client"
+	v3 "github.com/inonius/v3cli/api/v3"
+	"github.com/ipinfo/go/v2/ipinfo"
+	"github.com/librespeed/speedtest-cli/report"
+	"github.com/spf13/viper"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// testResult is a fixed dual-stack run, names contain the characters the output formats have to escape
+func testResult() *clientTypes.Result {
+	mss4, mss6 := 1414, 1440
+	flets := v3.FletsRegionEast
+	orgID := "lab a,b=c"
+	at := time.Date(2025, 6, 10, 3, 0, 0, 0, time.UTC)
+	return &clientTypes.Result{
+		Parameters:    clientTypes.SpeedtestParameters{Concurrent: 4, Duration: 15, Engine: "native", Bufferbloat: true, Unit: "Mbps"},
+		IPv4Available: true,
+		IPv6Available: true,
+		ClientInfoPair: clientTypes.ClientInfoPair{
+			IPv4Info: v3.ClientInfo{
+				IP: net.ParseIP("203.0.113.133"), Port: 50123, IsIPv4: true,
+				IPInfo: ipinfo.Core{Org: "AS64500 Example Net, Inc.", ASN: &ipinfo.CoreASN{ASN: "AS64500"}},
+			},
+			IPv6Info: v3.ClientInfo{
+				IP: net.ParseIP("3fff:1:0:1001::200e:20"), Port: 50124,
+				IPInfo: ipinfo.Core{Org: "AS64500 Example Net, Inc.", ASN: &ipinfo.CoreASN{ASN: "AS64500"}},
+			},
+		},
+		AccessTypeSession: v3.AccessTypeSession{
+			IPv4Mss:            &mss4,
+			IPv6Mss:            &mss6,
+			IPv4ConnectionType: &v3.ConnectionType{Name: "PPPoE", Mss: 1414},
+			IPv6ConnectionType: &v3.ConnectionType{Name: "IPoE", Mss: 1440},
+			Flets:              &flets,
+		},
+		AccessTypeGuess: clientTypes.AccessTypeGuessPair{
+			IPv4: &clientTypes.AccessTypeGuess{Name: "PPPoE", Confidence: 0.9, Mtu: 1454},
+			IPv6: &clientTypes.AccessTypeGuess{Name: "IPoE", Confidence: 0.8, Mtu: 1500},
+		},
+		SpeedtestResultPair: clientTypes.SpeedtestResultPair{
+			IPv4Results: []*clientTypes.SpeedtestResult{{
+				JSONReport: report.JSONReport{
+					Timestamp:     at.Add(5 * time.Second),
+					Server:        report.Server{Name: `Tokyo 1, "east"`},
+					BytesSent:     104857600,
+					BytesReceived: 471859200,
+					Ping:          7.25,
+					Jitter:        0.5,
+					Upload:        55.92,
+					Download:      251.66,
+				},
+				Engine: "native",
+				Bufferbloat: &clientTypes.Bufferbloat{
+					IdleRTT:  7.25,
+					Download: &clientTypes.LoadedLatency{RTT: 48.5, Delta: 41.25, Grade: "B", Probes: 30},
+					Upload:   &clientTypes.LoadedLatency{RTT: 19, Delta: 11.75, Grade: "A", Probes: 30},
+					Grade:    "B",
+				},
+			}},
+			IPv6Results: []*clientTypes.SpeedtestResult{{
+				JSONReport: report.JSONReport{
+					Timestamp: at.Add(40 * time.Second),
+					Server:    report.Server{Name: "Osaka=2"},
+					BytesSent: 209715200,
+					Ping:      5.5,
+					Jitter:    0.25,
+					Upload:    111.85,
+				},
+				DownloadSkipped: true,
+				Engine:          "native",
+			}},
+		},
+		Session: v3.SpeedtestSession{
+			CreatedAt: at,
+			DeviceId:  "5f1c2a9e-3b7d-4e0a-8c6f-1d2e3f4a5b6c",
+			OrgId:     &orgID,
+		},
+	}
+}
+
+// setViper sets a setting for the test only
+func setViper(t *testing.T, key string, value any) {
+	t.Helper()
+	old, set := viper.Get(key), viper.IsSet(key)
+	viper.Set(key, value)
+	t.Cleanup(func() {
+		if set {
+			viper.Set(key, old)
+		} else {
+			viper.Set(key, nil)
+		}
+	})
+}
+
+// golden compares got to testdata/name, go test -update rewrites it
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("%s differs from the golden file:\n--- got\n%s\n--- want\n%s", name, got, want)
+	}
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"io"
+	"os"
+	"time"
+
+	clientTypes "github.com/inonius/v3cli/api/client"
+	v3 "github.com/inonius/v3cli/api/v3"
+	"github.com/inonius/v3cli/pkg/speedtest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/spf13/viper"
+)
+
+const metricNamespace = "inonius"
+
+var (
+	familyLabels = []string{"family", "device_id", "asn", "org_tag"}
+	serverLabels = []string{"family", "server", "device_id", "asn", "org_tag"}
+)
+
+// resultRegistry renders the result as gauges, skipped phases and unavailable families are left out
+func resultRegistry(result *clientTypes.Result) *prometheus.Registry {
+	gauge := func(name, help string, labels []string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: metricNamespace, Name: name, Help: help}, labels)
+	}
+	var (
+		available     = gauge("available", "1 if the address family reached the api", familyLabels)
+		mss           = gauge("mss_bytes", "TCP MSS seen by the api", familyLabels)
+		download      = gauge("download_bits_per_second", "Download throughput", serverLabels)
+		upload        = gauge("upload_bits_per_second", "Upload throughput", serverLabels)
+		ping          = gauge("ping_seconds", "Idle round trip time", serverLabels)
+		jitter        = gauge("jitter_seconds", "Jitter of the idle round trip time", serverLabels)
+		bytesReceived = gauge("download_bytes", "Bytes received during the download", serverLabels)
+		bytesSent     = gauge("upload_bytes", "Bytes sent during the upload", serverLabels)
+		timestamp     = prometheus.NewGauge(prometheus.GaugeOpts{Namespace: metricNamespace, Name: "last_run_timestamp_seconds", Help: "Time of the run"})
+	)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(available, mss, download, upload, ping, jitter, bytesReceived, bytesSent, timestamp)
+
+	deviceID := result.Session.DeviceId
+	// the finished session does not always echo the tag back
+	orgTag := viper.GetString("orgtag")
+	if result.Session.OrgId != nil {
+		orgTag = *result.Session.OrgId
+	}
+	timestamp.Set(float64(time.Now().Unix()))
+	if !result.Session.CreatedAt.IsZero() {
+		timestamp.Set(float64(result.Session.CreatedAt.Unix()))
+	}
+
+	for _, family := range []struct {
+		name      string
+		available bool
+		info      *v3.ClientInfo
+		mss       *int
+		results   []*clientTypes.SpeedtestResult
+	}{
+		{"IPv4", result.IPv4Available, &result.ClientInfoPair.IPv4Info, result.AccessTypeSession.IPv4Mss, result.SpeedtestResultPair.IPv4Results},
+		{"IPv6", result.IPv6Available, &result.ClientInfoPair.IPv6Info, result.AccessTypeSession.IPv6Mss, result.SpeedtestResultPair.IPv6Results},
+	} {
+		var asn string
+		if family.info.IPInfo.ASN != nil {
+			asn = family.info.IPInfo.ASN.ASN
+		}
+		labels := prometheus.Labels{"family": family.name, "device_id": deviceID, "asn": asn, "org_tag": orgTag}
+
+		if !family.available {
+			available.With(labels).Set(0)
+			continue
+		}
+		available.With(labels).Set(1)
+		if family.mss != nil {
+			mss.With(labels).Set(float64(*family.mss))
+		}
+
+		for _, r := range family.results {
+			sl := prometheus.Labels{"server": r.Server.Name}
+			for k, v := range labels {
+				sl[k] = v
+			}
+			if !r.DownloadSkipped {
+				download.With(sl).Set(speedtest.BitsPerSecond(result.Parameters.Unit, r.Download))
+				bytesReceived.With(sl).Set(float64(r.BytesReceived))
+			}
+			if !r.UploadSkipped {
+				upload.With(sl).Set(speedtest.BitsPerSecond(result.Parameters.Unit, r.Upload))
+				bytesSent.With(sl).Set(float64(r.BytesSent))
+			}
+			ping.With(sl).Set(r.Ping / 1000)
+			jitter.With(sl).Set(r.Jitter / 1000)
+		}
+	}
+	return registry
+}
+
+// printPrometheus writes the text exposition format to --prometheus-file, atomically so that
+// the node_exporter textfile collector never reads a partial file, or to stdout
+func printPrometheus(result *clientTypes.Result) error {
+	if path := viper.GetString("prometheus-file"); path != "" {
+		return prometheus.WriteToTextfile(path, resultRegistry(result))
+	}
+	return writePrometheus(os.Stdout, result)
+}
+
+func writePrometheus(w io.Writer, result *clientTypes.Result) error {
+	families, err := resultRegistry(result).Gather()
+	if err != nil {
+		return err
+	}
+	for _, mf := range families {
+		if _, err := expfmt.MetricFamilyToText(w, mf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package client
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writePrometheus(&buf, testResult()); err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "result.prom", buf.Bytes())
+}
+
+func TestWritePrometheusUnavailableFamily(t *testing.T) {
+	// without an org id echoed by the session, the --orgtag flag is the label
+	setViper(t, "orgtag", "lab")
+	result := testResult()
+	result.Session.OrgId = nil
+	result.IPv6Available = false
+
+	var buf bytes.Buffer
+	if err := writePrometheus(&buf, result); err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "result_ipv4_only.prom", buf.Bytes())
+}
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	clientTypes "github.com/inonius/v3cli/api/client"
+	v3 "github.com/inonius/v3cli/api/v3"
+	"github.com/inonius/v3cli/pkg/speedtest"
+)
+
+// quicProbe runs the QUIC/HTTP3 oneshot test against every QUIC server on every available family
+func quicProbe(ctx context.Context, clientInstance *clientTypes.Client, servers []v3.OneshotTestServer) []*clientTypes.QUICResult {
+	if len(servers) == 0 {
+		logger.Debug("no QUIC oneshot server")
+		return nil
+	}
+
+	var families []bool
+	if clientInstance.Result.IPv4Available {
+		families = append(families, true)
+	}
+	if clientInstance.Result.IPv6Available {
+		families = append(families, false)
+	}
+
+	var results []*clientTypes.QUICResult
+	for _, server := range servers {
+		for _, isIPv4 := range families {
+			logger.Info(fmt.Sprintf("=====Starting %s QUIC/HTTP3 test...=====", familyName(isIPv4)))
+			r := speedtest.QUICProbe(ctx, *clientInstance, server.HTTPEndpoint, isIPv4)
+			logQUIC(r, clientInstance.Result.Parameters.Unit)
+			results = append(results, r)
+		}
+	}
+	return results
+}
+
+func logQUIC(r *clientTypes.QUICResult, unit string) {
+	switch r.Status {
+	case speedtest.QUICStatusBlocked:
+		logger.Warn(fmt.Sprintf("%s QUIC handshake timed out, UDP looks blocked", r.Family), "endpoint", r.Endpoint)
+		return
+	case speedtest.QUICStatusError:
+		logger.Error(fmt.Sprintf("%s QUIC test failed", r.Family), "endpoint", r.Endpoint, "error", r.Error)
+		return
+	}
+	logger.Info(fmt.Sprintf("%s QUIC handshake %.2fms, ALPN %s", r.Family, r.Handshake, r.Protocol))
+	if r.TCPThroughput == 0 {
+		logger.Info(fmt.Sprintf("%s HTTP/3 %.2f%s", r.Family, r.Throughput, unit))
+		return
+	}
+	logger.Info(fmt.Sprintf("%s HTTP/3 %.2f%s, TCP %.2f%s", r.Family, r.Throughput, unit, r.TCPThroughput, unit))
+	if r.Throttled {
+		logger.Warn(fmt.Sprintf("%s QUIC is much slower than TCP, UDP looks throttled", r.Family))
+	}
+}
@@ -0,0 +1,251 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	clientTypes "github.com/inonius/v3cli/api/client"
+	"github.com/inonius/v3cli/pkg/history"
+	"github.com/inonius/v3cli/pkg/speedtest"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var reportCmd *cobra.Command = &cobra.Command{
+	Use:   "report",
+	Short: "Summarise the saved runs by hour and day of the week, and compare them to a baseline period",
+	Args:  cobra.NoArgs,
+	RunE:  reportFn,
+}
+
+func reportFn(cmd *cobra.Command, args []string) error {
+	f, err := historyFilter(cmd)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if f.Until.IsZero() {
+		f.Until = now
+	}
+	if f.Since.IsZero() || !f.Since.Before(f.Until) {
+		return fmt.Errorf("--since must be before --until")
+	}
+
+	// the period of the same length just before by default
+	baseline := f
+	since, _ := cmd.Flags().GetString("baseline-since")
+	until, _ := cmd.Flags().GetString("baseline-until")
+	if baseline.Since, err = parseHistoryTime(since, now); err != nil {
+		return fmt.Errorf("invalid --baseline-since: %w", err)
+	}
+	if baseline.Until, err = parseHistoryTime(until, now); err != nil {
+		return fmt.Errorf("invalid --baseline-until: %w", err)
+	}
+	if baseline.Until.IsZero() {
+		baseline.Until = f.Since
+	}
+	if baseline.Since.IsZero() {
+		baseline.Since = baseline.Until.Add(-f.Until.Sub(f.Since))
+	}
+	threshold, _ := cmd.Flags().GetFloat64("threshold")
+	if threshold < 0 {
+		return fmt.Errorf("--threshold must not be negative")
+	}
+	markdown, _ := cmd.Flags().GetBool("markdown")
+
+	cmd.SilenceUsage = true
+	store, err := openHistory()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	results, err := store.Results(f)
+	if err != nil {
+		return err
+	}
+	baselineResults, err := store.Results(baseline)
+	if err != nil {
+		return err
+	}
+
+	unit := speedtest.Unit(clientTypes.Config{Bytes: viper.GetBool("bytes"), MebiBytes: viper.GetBool("mebibytes")})
+	report := history.NewReport(results, baselineResults, unit, threshold, time.Local)
+	report.Since, report.Until = f.Since, f.Until
+	report.BaselineSince, report.BaselineUntil = baseline.Since, baseline.Until
+
+	if jsonOutput() {
+		return printJSON(report)
+	}
+	return writeReport(os.Stdout, report, markdown)
+}
+
+// reportWriter renders the report as aligned text or as Markdown
+type reportWriter struct {
+	w        io.Writer
+	markdown bool
+}
+
+func (rw reportWriter) heading(s string) {
+	if rw.markdown {
+		fmt.Fprintf(rw.w, "## %s\n\n", s)
+		return
+	}
+	fmt.Fprintf(rw.w, "%s\n", s)
+}
+
+func (rw reportWriter) paragraph(lines ...string) {
+	for _, line := range lines {
+		if rw.markdown {
+			line = "- " + line
+		}
+		fmt.Fprintln(rw.w, line)
+	}
+	fmt.Fprintln(rw.w)
+}
+
+func (rw reportWriter) table(header []string, rows [][]string) error {
+	if rw.markdown {
+		fmt.Fprintf(rw.w, "| %s |\n", strings.Join(header, " | "))
+		fmt.Fprintf(rw.w, "|%s\n", strings.Repeat(" --- |", len(header)))
+		for _, row := range rows {
+			fmt.Fprintf(rw.w, "| %s |\n", strings.Join(row, " | "))
+		}
+		fmt.Fprintln(rw.w)
+		return nil
+	}
+	tw := tabwriter.NewWriter(rw.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintln(rw.w)
+	return nil
+}
+
+func writeReport(w io.Writer, report *history.Report, markdown bool) error {
+	rw := reportWriter{w: w, markdown: markdown}
+	const layout = "2006-01-02 15:04"
+	if markdown {
+		fmt.Fprintf(w, "# Speedtest report\n\n")
+	}
+	rw.paragraph(
+		fmt.Sprintf("Period: %s - %s", report.Since.Local().Format(layout), report.Until.Local().Format(layout)),
+		fmt.Sprintf("Baseline: %s - %s", report.BaselineSince.Local().Format(layout), report.BaselineUntil.Local().Format(layout)),
+	)
+	if len(report.Families) == 0 {
+		rw.paragraph("No results in the period")
+		return nil
+	}
+
+	for _, fr := range report.Families {
+		title := fmt.Sprintf("%s: %d results", fr.Family, fr.Count)
+		if fr.Baseline != nil {
+			title += fmt.Sprintf(", %d in the baseline", fr.Baseline.Count)
+		}
+		rw.heading(title)
+
+		base := fr.Baseline
+		if base == nil {
+			base = &history.Summary{}
+		}
+		var rows [][]string
+		for _, m := range []struct {
+			name, unit  string
+			stats, base *history.Stats
+		}{
+			{"Download", report.Unit, fr.Download, base.Download},
+			{"Upload", report.Unit, fr.Upload, base.Upload},
+			{"RTT", "ms", fr.Ping, base.Ping},
+			{"Jitter", "ms", fr.Jitter, base.Jitter},
+		} {
+			if m.stats == nil {
+				rows = append(rows, []string{m.name, m.unit, "-", "-", "-", "-", medianString(m.base), ""})
+				continue
+			}
+			rows = append(rows, []string{m.name, m.unit, formatStat(m.stats.Min), formatStat(m.stats.Median), formatStat(m.stats.P95), formatStat(m.stats.Max),
+				medianString(m.base), changeString(m.stats, m.base)})
+		}
+		if err := rw.table([]string{"METRIC", "UNIT", "MIN", "MEDIAN", "P95", "MAX", "BASELINE MEDIAN", "CHANGE"}, rows); err != nil {
+			return err
+		}
+
+		switch {
+		case fr.Baseline == nil:
+			rw.paragraph("No baseline results to compare with")
+		case len(fr.Regressions) == 0:
+			rw.paragraph(fmt.Sprintf("No regression against the baseline (threshold %.0f%%)", report.Threshold*100))
+		default:
+			var lines []string
+			for _, r := range fr.Regressions {
+				unit := report.Unit
+				if r.Metric == "ping" || r.Metric == "jitter" {
+					unit = "ms"
+				}
+				line := fmt.Sprintf("Regression: %s median %s -> %s %s (%+.1f%%)", r.Metric, formatStat(r.Baseline), formatStat(r.Current), unit, r.Change*100)
+				if markdown {
+					line = "**" + line + "**"
+				}
+				lines = append(lines, line)
+			}
+			rw.paragraph(lines...)
+		}
+
+		for _, groups := range []struct {
+			key    string
+			groups []history.Group
+		}{{"HOUR", fr.ByHour}, {"DAY", fr.ByWeekday}} {
+			rows = nil
+			for _, g := range groups.groups {
+				rows = append(rows, []string{g.Key, strconv.Itoa(g.Count), groupString(g.Download), groupString(g.Upload), groupString(g.Ping), groupString(g.Jitter)})
+			}
+			header := []string{groups.key, "RESULTS", "DOWNLOAD MEDIAN/P95", "UPLOAD MEDIAN/P95", "RTT MEDIAN/P95", "JITTER MEDIAN/P95"}
+			if err := rw.table(header, rows); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func formatStat(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+func medianString(s *history.Stats) string {
+	if s == nil {
+		return "-"
+	}
+	return formatStat(s.Median)
+}
+
+func changeString(current, base *history.Stats) string {
+	if current == nil || base == nil || base.Median <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%+.1f%%", (current.Median-base.Median)/base.Median*100)
+}
+
+func groupString(s *history.Stats) string {
+	if s == nil {
+		return "-"
+	}
+	return formatStat(s.Median) + " / " + formatStat(s.P95)
+}
+
+func init() {
+	addHistoryFilterFlags(reportCmd, "7d")
+	reportCmd.Flags().StringP("baseline-since", "", "", "Start of the baseline period (default: the period of the same length before --since)")
+	reportCmd.Flags().StringP("baseline-until", "", "", "End of the baseline period (default: --since)")
+	reportCmd.Flags().Float64P("threshold", "", 0.1, "Relative change of a median against the baseline reported as a regression")
+	reportCmd.Flags().BoolP("markdown", "", false, "Render the report as Markdown, e.g. for a ticket")
+	cmd.AddCommand(reportCmd)
+}
@@ -0,0 +1,161 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+
+	clientTypes "github.com/inonius/v3cli/api/client"
+	"github.com/invopop/jsonschema"
+	validator "github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/spf13/cobra"
+)
+
+//go:generate sh -c "go run ../.. schema > ../../schema/simplified_result.schema.json"
+
+const schemaFileName = "simplified_result.schema.json"
+
+var schemaCmd *cobra.Command = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of the --json output",
+	Args:  cobra.NoArgs,
+	RunE:  schemaFn,
+}
+
+var validateCmd *cobra.Command = &cobra.Command{
+	Use:   "validate <file>...",
+	Short: "Validate saved --json results against the JSON Schema, - reads stdin",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  validateFn,
+}
+
+type validation struct {
+	File  string `json:"file"`
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+}
+
+// simplifiedResultSchema generates the schema from the Go types, every field without omitempty is required
+func simplifiedResultSchema() ([]byte, error) {
+	r := &jsonschema.Reflector{
+		Mapper: func(t reflect.Type) *jsonschema.Schema {
+			// net.IP is mapped to ipv4 only by default
+			if t == reflect.TypeOf(net.IP{}) {
+				return &jsonschema.Schema{
+					Type:  "string",
+					AnyOf: []*jsonschema.Schema{{Format: "ipv4"}, {Format: "ipv6"}},
+				}
+			}
+			return nil
+		},
+	}
+	s := r.Reflect(&clientTypes.SimplifiedResult{})
+	s.Title = "inonius_v3cli --json result"
+	s.Description = fmt.Sprintf("schema_version %d", clientTypes.SimplifiedResultSchemaVersion)
+
+	// a result of another schema version is rejected rather than half matched
+	if def, ok := s.Definitions["SimplifiedResult"]; ok {
+		if p, ok := def.Properties.Get("schema_version"); ok {
+			p.Const = clientTypes.SimplifiedResultSchemaVersion
+		}
+	}
+	return json.MarshalIndent(s, "", "  ")
+}
+
+func schemaFn(cmd *cobra.Command, args []string) error {
+	s, err := simplifiedResultSchema()
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(s))
+	return nil
+}
+
+func validateFn(cmd *cobra.Command, args []string) error {
+	s, err := simplifiedResultSchema()
+	if err != nil {
+		return err
+	}
+	compiler := validator.NewCompiler()
+	compiler.AssertFormat = true
+	if err := compiler.AddResource(schemaFileName, bytes.NewReader(s)); err != nil {
+		return err
+	}
+	schema, err := compiler.Compile(schemaFileName)
+	if err != nil {
+		return err
+	}
+
+	var results []validation
+	invalid := 0
+	for _, file := range args {
+		v := validation{File: file}
+		if err := validateFile(schema, file); err != nil {
+			v.Error = err.Error()
+			invalid++
+		} else {
+			v.Valid = true
+		}
+		results = append(results, v)
+	}
+
+	if jsonOutput() {
+		if err := printJSON(results); err != nil {
+			return err
+		}
+	} else {
+		for _, v := range results {
+			if v.Valid {
+				fmt.Printf("%s: ok\n", v.File)
+				continue
+			}
+			fmt.Printf("%s: invalid\n%s\n", v.File, v.Error)
+		}
+	}
+
+	if invalid > 0 {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("%d of %d results are invalid", invalid, len(results))
+	}
+	return nil
+}
+
+// validateFile checks a single JSON document, numbers are kept as json.Number for exact integer checks
+func validateFile(schema *validator.Schema, file string) error {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return fmt.Errorf("not JSON: %w", err)
+	}
+	if dec.More() {
+		return fmt.Errorf("trailing data after the JSON document")
+	}
+	if err := schema.Validate(doc); err != nil {
+		// the detailed form lists every failing location, not only the first one
+		if verr, ok := err.(*validator.ValidationError); ok {
+			return fmt.Errorf("%#v", verr)
+		}
+		return err
+	}
+	return nil
+}
+
+func init() {
+	cmd.AddCommand(schemaCmd)
+	cmd.AddCommand(validateCmd)
+}
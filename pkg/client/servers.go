@@ -0,0 +1,82 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/inonius/v3cli/pkg/speedtest"
+	"github.com/librespeed/speedtest-cli/defs"
+	"github.com/spf13/cobra"
+)
+
+var serversCmd *cobra.Command = &cobra.Command{
+	Use:   "servers",
+	Short: "List the speedtest servers with their reachability and RTT",
+	Args:  cobra.NoArgs,
+	RunE:  serversFn,
+}
+
+type serverEntry struct {
+	ID     int     `json:"id"`
+	Name   string  `json:"name"`
+	Family string  `json:"family"`
+	URL    string  `json:"url"`
+	Up     bool    `json:"up"`
+	Ping   float64 `json:"ping"`
+}
+
+func serversFn(cmd *cobra.Command, args []string) error {
+	clientInstance, err := newClientInstance()
+	if err != nil {
+		return err
+	}
+	speedtestClient := NewSpeedtestClient(clientInstance)
+
+	server, err := speedtestClient.GetServers(context.Background())
+	if err != nil {
+		return err
+	}
+	ipv4server, ipv6server := ConvertLibrespeedServersToDefsServers(server.Librespeed)
+
+	var entries []serverEntry
+	for _, family := range []struct {
+		name    string
+		servers []defs.Server
+	}{{"IPv4", ipv4server}, {"IPv6", ipv6server}} {
+		statuses, err := speedtest.ProbeServers(*clientInstance, family.servers)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			entries = append(entries, serverEntry{
+				ID:     status.Server.ID,
+				Name:   status.Server.Name,
+				Family: family.name,
+				URL:    status.Server.Server,
+				Up:     status.Up,
+				Ping:   speedtest.RoundTo(status.Ping, 2),
+			})
+		}
+	}
+
+	if jsonOutput() {
+		return printJSON(entries)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tFAMILY\tURL\tSTATE\tRTT")
+	for _, e := range entries {
+		if !e.Up {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", e.ID, e.Name, e.Family, e.URL, "down", "-")
+			continue
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%.2f ms\n", e.ID, e.Name, e.Family, e.URL, "up", e.Ping)
+	}
+	return w.Flush()
+}
+
+func init() {
+	cmd.AddCommand(serversCmd)
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	clientTypes "github.com/inonius/v3cli/api/client"
+	"github.com/spf13/cobra"
+)
+
+var sessionCmd *cobra.Command = &cobra.Command{
+	Use:   "session",
+	Short: "Manage speedtest sessions",
+}
+
+var sessionFinishCmd *cobra.Command = &cobra.Command{
+	Use:   "finish <SESSION_UUID>",
+	Short: "Finish a speedtest session left open by an aborted run",
+	Args:  cobra.ExactArgs(1),
+	RunE:  sessionFinishFn,
+}
+
+func sessionFinishFn(cmd *cobra.Command, args []string) error {
+	clientInstance, err := newClientInstance()
+	if err != nil {
+		return err
+	}
+
+	clientInstance.Result.Session.UUID = args[0]
+	clientInstance.Result.Session.DeviceId = clientInstance.Config.DeviceId
+	if id, _ := cmd.Flags().GetString("speed-ipv4-id"); id != "" {
+		clientInstance.Result.SpeedtestResultPair.IPv4Result = &clientTypes.SpeedtestResult{ID: &id}
+	}
+	if id, _ := cmd.Flags().GetString("speed-ipv6-id"); id != "" {
+		clientInstance.Result.SpeedtestResultPair.IPv6Result = &clientTypes.SpeedtestResult{ID: &id}
+	}
+
+	speedtestClient := NewSpeedtestClient(clientInstance)
+	if err := speedtestClient.FinishSpeedtestSession(context.Background()); err != nil {
+		return err
+	}
+
+	if jsonOutput() {
+		return printJSON(clientInstance.Result.Session)
+	}
+	fmt.Println("Finished", clientInstance.Result.Session.UUID)
+	return nil
+}
+
+func init() {
+	sessionFinishCmd.Flags().StringP("speed-ipv4-id", "", "", "librespeed telemetry id of the IPv4 result")
+	sessionFinishCmd.Flags().StringP("speed-ipv6-id", "", "", "librespeed telemetry id of the IPv6 result")
+
+	sessionCmd.AddCommand(sessionFinishCmd)
+	cmd.AddCommand(sessionCmd)
+}
@@ -0,0 +1,204 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	clientTypes "github.com/inonius/v3cli/api/client"
+	"github.com/inonius/v3cli/pkg/speedtest"
+	"github.com/spf13/viper"
+)
+
+const OutputTemplate = "template"
+
+// quietTemplate is the line of --quiet, one per speedtest result, skipped phases and unknown access types are left out
+const quietTemplate = `{{range $f := .Families}}{{range .Results -}}
+{{$f.Name}}Address {{$f.Address}}
+{{- with $f.Mss}} {{$f.Name}}mss {{.}}{{end}}
+{{- with $f.AccessType}} {{$f.Name}}AccessType {{.}}{{end}}
+{{- with $f.LocalAccessType}} {{$f.Name}}LocalAccessType {{.}}{{end}}
+{{- with $.Flets}} Flets {{.}}{{end}}
+{{- if not .UploadSkipped}} {{$f.Name}}Upload {{.Upload}} {{$.Unit}}{{end}}
+{{- if not .DownloadSkipped}} {{$f.Name}}Download {{.Download}} {{$.Unit}}{{end}}
+{{- ""}} {{$f.Name}}RTT {{printf "%.2f" .Ping}} ms {{$f.Name}}Jitter {{.Jitter}} ms
+{{end}}{{end}}`
+
+// templateData is the dot of --format and --template-file, the full result is embedded
+type templateData struct {
+	*clientTypes.Result
+	Simplified clientTypes.SimplifiedResult
+	Unit       string
+	Flets      string
+	IPv4       *templateFamily // nil when IPv4 is not available, guard with {{with .IPv4}}
+	IPv6       *templateFamily
+	Families   []*templateFamily
+}
+
+// templateFamily is the client info of a family, the fields of its first speedtest result are promoted
+type templateFamily struct {
+	templateResult
+	Name            string // IPv4 or IPv6
+	Address         string
+	Org             string
+	Mss             *int
+	AccessType      string // detected by the api
+	LocalAccessType string // guessed locally
+	Results         []templateResult
+}
+
+type templateResult struct {
+	Server          string
+	Timestamp       time.Time
+	Download        float64
+	Upload          float64
+	DownloadSkipped bool
+	UploadSkipped   bool
+	Ping            float64
+	Jitter          float64
+	Bufferbloat     *clientTypes.Bufferbloat
+}
+
+func newTemplateData(result *clientTypes.Result) *templateData {
+	d := &templateData{
+		Result:     result,
+		Simplified: simplifiedResult(*result),
+		Unit:       result.Parameters.Unit,
+	}
+	if flets := result.AccessTypeSession.Flets; flets != nil {
+		d.Flets = string(*flets)
+	}
+	if result.IPv4Available {
+		d.IPv4 = newTemplateFamily(result, true)
+		d.Families = append(d.Families, d.IPv4)
+	}
+	if result.IPv6Available {
+		d.IPv6 = newTemplateFamily(result, false)
+		d.Families = append(d.Families, d.IPv6)
+	}
+	return d
+}
+
+func newTemplateFamily(result *clientTypes.Result, isIPv4 bool) *templateFamily {
+	ats := result.AccessTypeSession
+	info, mss, ct, guess, results := result.ClientInfoPair.IPv6Info, ats.IPv6Mss, ats.IPv6ConnectionType, result.AccessTypeGuess.IPv6, result.SpeedtestResultPair.IPv6Results
+	if isIPv4 {
+		info, mss, ct, guess, results = result.ClientInfoPair.IPv4Info, ats.IPv4Mss, ats.IPv4ConnectionType, result.AccessTypeGuess.IPv4, result.SpeedtestResultPair.IPv4Results
+	}
+
+	f := &templateFamily{
+		Name:    familyName(isIPv4),
+		Address: info.IP.String(),
+		Org:     info.IPInfo.Org,
+		Mss:     mss,
+	}
+	if ct != nil {
+		f.AccessType = ct.Name
+	}
+	if guess != nil {
+		f.LocalAccessType = guess.Name
+	}
+	for _, r := range results {
+		f.Results = append(f.Results, templateResult{
+			Server:          r.Server.Name,
+			Timestamp:       r.Timestamp,
+			Download:        r.Download,
+			Upload:          r.Upload,
+			DownloadSkipped: r.DownloadSkipped,
+			UploadSkipped:   r.UploadSkipped,
+			Ping:            r.Ping,
+			Jitter:          r.Jitter,
+			Bufferbloat:     r.Bufferbloat,
+		})
+	}
+	if len(f.Results) > 0 {
+		f.templateResult = f.Results[0]
+	}
+	return f
+}
+
+// templateFuncs are the helpers available in the templates, rates are taken in the unit of the result
+func templateFuncs(unit string) template.FuncMap {
+	return template.FuncMap{
+		// {{.IPv4.Download | round 1}}
+		"round": func(precision int, v float64) float64 { return speedtest.RoundTo(v, precision) },
+		"bits":  func(v float64) float64 { return speedtest.BitsPerSecond(unit, v) },
+		"bytes": func(v float64) float64 { return speedtest.BitsPerSecond(unit, v) / 8 },
+		"mbps":  func(v float64) float64 { return speedtest.BitsPerSecond(unit, v) / 1e6 },
+		// {{.IPv4.Download | convert "MiB/s"}}
+		"convert": func(to string, v float64) (float64, error) {
+			switch to {
+			case "Mbps", "Mibps", "MB/s", "MiB/s":
+				return speedtest.Convert(v, unit, to), nil
+			}
+			return 0, fmt.Errorf("unknown unit %q, available: Mbps, Mibps, MB/s, MiB/s", to)
+		},
+		// {{.IPv4.AccessType | default "unknown"}}
+		"default": func(def, v interface{}) interface{} {
+			if v == nil || v == "" {
+				return def
+			}
+			return v
+		},
+		"json": func(v interface{}) (string, error) {
+			j, err := json.Marshal(v)
+			return string(j), err
+		},
+		"join":  strings.Join,
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+	}
+}
+
+// resultTemplate parses --format or --template-file, --format gets a trailing newline like a quiet line
+func resultTemplate(unit string) (*template.Template, error) {
+	format, file := viper.GetString("format"), viper.GetString("template-file")
+	switch {
+	case format != "" && file != "":
+		return nil, fmt.Errorf("--format and --template-file are exclusive")
+	case file != "":
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the template file: %w", err)
+		}
+		format = string(b)
+	case format == "":
+		return nil, fmt.Errorf("--output %s requires --format or --template-file", OutputTemplate)
+	case !strings.HasSuffix(format, "\n"):
+		format += "\n"
+	}
+
+	t, err := template.New(OutputTemplate).Funcs(templateFuncs(unit)).Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return t, nil
+}
+
+func printTemplate(result *clientTypes.Result) error {
+	t, err := resultTemplate(result.Parameters.Unit)
+	if err != nil {
+		return err
+	}
+	return renderTemplate(os.Stdout, t, result)
+}
+
+func printQuiet(result *clientTypes.Result) error {
+	t := template.Must(template.New(OutputQuiet).Funcs(templateFuncs(result.Parameters.Unit)).Parse(quietTemplate))
+	return renderTemplate(os.Stdout, t, result)
+}
+
+// renderTemplate renders into a buffer first, so that a failing template prints nothing
+func renderTemplate(w io.Writer, t *template.Template, result *clientTypes.Result) error {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, newTemplateData(result)); err != nil {
+		return fmt.Errorf("failed to render the template: %w", err)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+)
+
+func TestQuietTemplate(t *testing.T) {
+	result := testResult()
+	tmpl := template.Must(template.New(OutputQuiet).Funcs(templateFuncs(result.Parameters.Unit)).Parse(quietTemplate))
+
+	var buf bytes.Buffer
+	if err := renderTemplate(&buf, tmpl, result); err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "result.quiet", buf.Bytes())
+}
+
+func TestFormatTemplate(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		want   string
+	}{
+		{"trailing newline added", "{{.IPv4.Download}}", "251.66\n"},
+		{"trailing newline kept", "{{.IPv4.Upload}}\n", "55.92\n"},
+		{"full result", "{{.Session.DeviceId}} {{.Parameters.Engine}}", "5f1c2a9e-3b7d-4e0a-8c6f-1d2e3f4a5b6c native\n"},
+		{"simplified result", "{{len .Simplified.SpeedtestResult}}", "2\n"},
+		{"round", "{{.IPv4.Download | round 0}}", "252\n"},
+		{"bits", "{{.IPv4.Download | bits}}", "2.5166e+08\n"},
+		{"bytes", "{{.IPv4.Download | bytes}}", "3.14575e+07\n"},
+		{"mbps", "{{.IPv4.Upload | mbps}}", "55.92\n"},
+		{"convert", `{{.IPv4.Download | convert "MB/s"}}`, "31.4575\n"},
+		{"default", `{{.IPv6.Server}} {{.Flets | default "none"}} {{"" | default "none"}}`, "Osaka=2 east none\n"},
+		{"json", "{{json .IPv4.Bufferbloat.Download}}", `{"rtt":48.5,"delta":41.25,"grade":"B","probes":30}` + "\n"},
+		{"upper and lower", "{{upper .IPv4.AccessType}} {{lower .IPv6.Name}}", "PPPOE ipv6\n"},
+		{"skipped phase", "{{with .IPv6}}{{if .DownloadSkipped}}skipped{{else}}{{.Download}}{{end}}{{end}}", "skipped\n"},
+		{"every family", "{{range .Families}}{{.Name}} {{.Address}} {{.LocalAccessType}};{{end}}", "IPv4 203.0.113.133 PPPoE;IPv6 3fff:1:0:1001::200e:20 IPoE;\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setViper(t, "format", tt.format)
+			result := testResult()
+			tmpl, err := resultTemplate(result.Parameters.Unit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := renderTemplate(&buf, tmpl, result); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "result.tmpl")
+	if err := os.WriteFile(path, []byte("{{.IPv4.Server}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	setViper(t, "template-file", path)
+
+	result := testResult()
+	tmpl, err := resultTemplate(result.Parameters.Unit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := renderTemplate(&buf, tmpl, result); err != nil {
+		t.Fatal(err)
+	}
+	// a file is rendered as is, without a trailing newline
+	if got, want := buf.String(), `Tokyo 1, "east"`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestResultTemplateErrors(t *testing.T) {
+	tests := []struct {
+		name, format, file string
+	}{
+		{"neither", "", ""},
+		{"both", "{{.Unit}}", "result.tmpl"},
+		{"missing file", "", filepath.Join(t.TempDir(), "missing.tmpl")},
+		{"parse error", "{{.Unit", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setViper(t, "format", tt.format)
+			setViper(t, "template-file", tt.file)
+			if _, err := resultTemplate("Mbps"); err == nil {
+				t.Errorf("resultTemplate() succeeded")
+			}
+		})
+	}
+}
+
+func TestRenderTemplateFailurePrintsNothing(t *testing.T) {
+	setViper(t, "format", `{{.IPv4.Download}} {{.IPv4.Download | convert "furlongs"}}`)
+	result := testResult()
+	tmpl, err := resultTemplate(result.Parameters.Unit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := renderTemplate(&buf, tmpl, result); err == nil {
+		t.Errorf("renderTemplate() succeeded with an unknown unit")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("a failing template printed %q", buf.String())
+	}
+}
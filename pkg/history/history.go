@@ -0,0 +1,267 @@
+// Package history keeps the results of past runs in a local SQLite database
+package history
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	clientTypes "github.com/inonius/v3cli/api/client"
+	v3 "github.com/inonius/v3cli/api/v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var ErrNotFound = errors.New("run not found")
+
+// Run is one stored run, keyed by the session UUID.
+// The complete result is kept as JSON, the columns are what the filters and the listing need.
+// Times are stored in UTC, so that they compare as text in SQLite.
+type Run struct {
+	UUID           string               `gorm:"primaryKey" json:"uuid"`
+	CreatedAt      time.Time            `gorm:"index" json:"created_at"`
+	ClientVersion  string               `json:"client_version"`
+	Interface      string               `gorm:"index" json:"interface,omitempty"`
+	Source         string               `json:"source,omitempty"`
+	Unit           string               `json:"unit"`
+	IPv4Address    string               `json:"ipv4_address,omitempty"`
+	IPv6Address    string               `json:"ipv6_address,omitempty"`
+	IPv4Mss        *int                 `json:"ipv4_mss,omitempty"`
+	IPv6Mss        *int                 `json:"ipv6_mss,omitempty"`
+	IPv4AccessType string               `json:"ipv4_access_type,omitempty"` // detected by the api
+	IPv6AccessType string               `json:"ipv6_access_type,omitempty"`
+	Flets          string               `json:"flets,omitempty"`
+	Session        *v3.SpeedtestSession `gorm:"foreignKey:UUID;references:UUID" json:"-"`
+	Result         *clientTypes.Result  `gorm:"serializer:json" json:"-"`
+	Results        []RunResult          `gorm:"foreignKey:RunUUID;references:UUID" json:"results,omitempty"`
+}
+
+// RunResult is one speedtest of a run, skipped phases are NULL
+type RunResult struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	RunUUID   string    `gorm:"index" json:"uuid"`
+	Run       *Run      `gorm:"foreignKey:RunUUID;references:UUID" json:"-"`
+	Family    string    `gorm:"index" json:"family"` // IPv4 or IPv6
+	Server    string    `gorm:"index" json:"server"`
+	Timestamp time.Time `gorm:"index" json:"timestamp"`
+	Download  *float64  `json:"download,omitempty"`
+	Upload    *float64  `json:"upload,omitempty"`
+	Ping      float64   `json:"ping"`
+	Jitter    float64   `json:"jitter"`
+	Unit      string    `json:"unit"`
+}
+
+// Filter selects runs, the zero value selects everything
+type Filter struct {
+	UUIDs     []string
+	Since     time.Time
+	Until     time.Time
+	Family    string // IPv4 or IPv6, runs with a result of the family
+	Server    string // glob pattern of the server name, runs with a result on a matching server
+	Interface string
+	Limit     int // newest runs first
+}
+
+type Store struct {
+	db *gorm.DB
+}
+
+// Open opens or creates the database at path
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{
+		Logger:  logger.Default.LogMode(logger.Silent),
+		NowFunc: func() time.Time { return time.Now().UTC() },
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the history database %s: %w", path, err)
+	}
+	if err := db.AutoMigrate(&v3.SpeedtestSession{}, &Run{}, &RunResult{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate the history database %s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// DefaultPath is history.db in the user config directory
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "inonius_v3cli", "history.db")
+}
+
+func (s *Store) Close() error {
+	db, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+// Save stores a finished run, a run with the same session UUID is replaced
+func (s *Store) Save(result *clientTypes.Result, clientVersion, iface, source string) (*Run, error) {
+	if result.Session.UUID == "" {
+		return nil, fmt.Errorf("the result has no session")
+	}
+	run := newRun(result, clientVersion, iface, source)
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := deleteRuns(tx, []string{run.UUID}); err != nil {
+			return err
+		}
+		return tx.Create(run).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+func newRun(result *clientTypes.Result, clientVersion, iface, source string) *Run {
+	session := result.Session
+	ats := result.AccessTypeSession
+	run := &Run{
+		UUID:          session.UUID,
+		CreatedAt:     session.CreatedAt.UTC(),
+		ClientVersion: clientVersion,
+		Interface:     iface,
+		Source:        source,
+		Unit:          result.Parameters.Unit,
+		IPv4Mss:       ats.IPv4Mss,
+		IPv6Mss:       ats.IPv6Mss,
+		Session:       &session,
+		Result:        result,
+	}
+	if run.CreatedAt.IsZero() {
+		run.CreatedAt = time.Now().UTC()
+	}
+	if result.IPv4Available {
+		run.IPv4Address = result.ClientInfoPair.IPv4Info.IP.String()
+	}
+	if result.IPv6Available {
+		run.IPv6Address = result.ClientInfoPair.IPv6Info.IP.String()
+	}
+	if ats.IPv4ConnectionType != nil {
+		run.IPv4AccessType = ats.IPv4ConnectionType.Name
+	}
+	if ats.IPv6ConnectionType != nil {
+		run.IPv6AccessType = ats.IPv6ConnectionType.Name
+	}
+	if ats.Flets != nil {
+		run.Flets = string(*ats.Flets)
+	}
+
+	for _, family := range []struct {
+		name    string
+		results []*clientTypes.SpeedtestResult
+	}{{"IPv4", result.SpeedtestResultPair.IPv4Results}, {"IPv6", result.SpeedtestResultPair.IPv6Results}} {
+		for _, r := range family.results {
+			rr := RunResult{
+				Family:    family.name,
+				Server:    r.Server.Name,
+				Timestamp: r.Timestamp.UTC(),
+				Ping:      r.Ping,
+				Jitter:    r.Jitter,
+				Unit:      run.Unit,
+			}
+			if !r.DownloadSkipped {
+				rr.Download = &r.Download
+			}
+			if !r.UploadSkipped {
+				rr.Upload = &r.Upload
+			}
+			run.Results = append(run.Results, rr)
+		}
+	}
+	return run
+}
+
+// runs selects the runs matching f, without its limit
+func (s *Store) runs(f Filter) *gorm.DB {
+	q := s.db.Model(&Run{})
+	if len(f.UUIDs) > 0 {
+		q = q.Where("runs.uuid IN ?", f.UUIDs)
+	}
+	if !f.Since.IsZero() {
+		q = q.Where("runs.created_at >= ?", f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		q = q.Where("runs.created_at < ?", f.Until.UTC())
+	}
+	if f.Interface != "" {
+		q = q.Where("runs.interface = ?", f.Interface)
+	}
+	if f.Family != "" || f.Server != "" {
+		q = q.Where("runs.uuid IN (?)", resultConditions(s.db.Model(&RunResult{}).Select("run_uuid"), f))
+	}
+	return q
+}
+
+func resultConditions(q *gorm.DB, f Filter) *gorm.DB {
+	if f.Family != "" {
+		q = q.Where("run_results.family = ?", f.Family)
+	}
+	if f.Server != "" {
+		q = q.Where("run_results.server GLOB ?", f.Server)
+	}
+	return q
+}
+
+// Runs returns the runs matching f with their results, newest first
+func (s *Store) Runs(f Filter) ([]Run, error) {
+	q := s.runs(f).Preload("Results", func(db *gorm.DB) *gorm.DB {
+		return resultConditions(db, f).Order("run_results.timestamp")
+	}).Order("runs.created_at DESC")
+	if f.Limit > 0 {
+		q = q.Limit(f.Limit)
+	}
+	var runs []Run
+	return runs, q.Find(&runs).Error
+}
+
+// Run returns the run of the session UUID, a unique prefix is enough
+func (s *Store) Run(uuid string) (*Run, error) {
+	var runs []Run
+	err := s.db.Preload("Results", func(db *gorm.DB) *gorm.DB {
+		return db.Order("run_results.timestamp")
+	}).Where("uuid LIKE ?", uuid+"%").Limit(2).Find(&runs).Error
+	switch {
+	case err != nil:
+		return nil, err
+	case len(runs) == 0:
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, uuid)
+	case len(runs) > 1:
+		return nil, fmt.Errorf("%s matches more than one run", uuid)
+	}
+	return &runs[0], nil
+}
+
+// Delete removes the runs matching f and returns their UUIDs
+func (s *Store) Delete(f Filter) ([]string, error) {
+	var uuids []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := (&Store{db: tx}).runs(f).Pluck("runs.uuid", &uuids).Error; err != nil {
+			return err
+		}
+		return deleteRuns(tx, uuids)
+	})
+	return uuids, err
+}
+
+func deleteRuns(tx *gorm.DB, uuids []string) error {
+	if len(uuids) == 0 {
+		return nil
+	}
+	if err := tx.Where("run_uuid IN ?", uuids).Delete(&RunResult{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("uuid IN ?", uuids).Delete(&Run{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("uuid IN ?", uuids).Delete(&v3.SpeedtestSession{}).Error
+}
@@ -0,0 +1,188 @@
+package history
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/inonius/v3cli/pkg/speedtest"
+)
+
+// Stats summarises the values of one metric
+type Stats struct {
+	Count  int     `json:"count"`
+	Min    float64 `json:"min"`
+	Median float64 `json:"median"`
+	P95    float64 `json:"p95"`
+	Max    float64 `json:"max"`
+}
+
+// Summary is the statistics of a set of results, a metric without any value (skipped phases) is nil
+type Summary struct {
+	Count    int    `json:"count"`
+	Download *Stats `json:"download,omitempty"`
+	Upload   *Stats `json:"upload,omitempty"`
+	Ping     *Stats `json:"ping,omitempty"`
+	Jitter   *Stats `json:"jitter,omitempty"`
+}
+
+// Group is the summary of the results in one hour of the day (00-23) or day of the week (Mon-Sun)
+type Group struct {
+	Key string `json:"key"`
+	Summary
+}
+
+// Regression is a median worse than the baseline by more than the threshold
+type Regression struct {
+	Metric   string  `json:"metric"` // download, upload, ping or jitter
+	Baseline float64 `json:"baseline"`
+	Current  float64 `json:"current"`
+	Change   float64 `json:"change"` // relative to the baseline, -0.2 is 20% lower
+}
+
+type FamilyReport struct {
+	Family string `json:"family"`
+	Summary
+	Baseline    *Summary     `json:"baseline,omitempty"`
+	Regressions []Regression `json:"regressions"`
+	ByHour      []Group      `json:"by_hour"`
+	ByWeekday   []Group      `json:"by_weekday"`
+}
+
+// Report is the trend of the results in a period, rates are converted into Unit, ping and jitter are in ms
+type Report struct {
+	Since         time.Time      `json:"since"`
+	Until         time.Time      `json:"until"`
+	BaselineSince time.Time      `json:"baseline_since"`
+	BaselineUntil time.Time      `json:"baseline_until"`
+	Unit          string         `json:"unit"`
+	Threshold     float64        `json:"threshold"`
+	Families      []FamilyReport `json:"families"`
+}
+
+// Results returns the results of the runs matching f, oldest first
+func (s *Store) Results(f Filter) ([]RunResult, error) {
+	var results []RunResult
+	err := resultConditions(s.db.Model(&RunResult{}), f).
+		Where("run_results.run_uuid IN (?)", s.runs(f).Select("runs.uuid")).
+		Order("run_results.timestamp").
+		Find(&results).Error
+	return results, err
+}
+
+// NewReport summarises results per family, by hour and by day of the week in loc, and compares them to baseline.
+// The report period is left to the caller.
+func NewReport(results, baseline []RunResult, unit string, threshold float64, loc *time.Location) *Report {
+	r := &Report{Unit: unit, Threshold: threshold, Families: []FamilyReport{}}
+	for _, family := range []string{"IPv4", "IPv6"} {
+		current := byFamily(results, family)
+		if len(current) == 0 {
+			continue
+		}
+		fr := FamilyReport{
+			Family:      family,
+			Summary:     summarize(current, unit),
+			Regressions: []Regression{},
+		}
+		if base := byFamily(baseline, family); len(base) > 0 {
+			s := summarize(base, unit)
+			fr.Baseline = &s
+			fr.Regressions = regressions(s, fr.Summary, threshold)
+		}
+
+		hours := map[int][]RunResult{}
+		weekdays := map[time.Weekday][]RunResult{}
+		for _, rr := range current {
+			t := rr.Timestamp.In(loc)
+			hours[t.Hour()] = append(hours[t.Hour()], rr)
+			weekdays[t.Weekday()] = append(weekdays[t.Weekday()], rr)
+		}
+		for hour := 0; hour < 24; hour++ {
+			if rs := hours[hour]; len(rs) > 0 {
+				fr.ByHour = append(fr.ByHour, Group{Key: fmt.Sprintf("%02d", hour), Summary: summarize(rs, unit)})
+			}
+		}
+		// monday first
+		for i := 1; i <= 7; i++ {
+			weekday := time.Weekday(i % 7)
+			if rs := weekdays[weekday]; len(rs) > 0 {
+				fr.ByWeekday = append(fr.ByWeekday, Group{Key: weekday.String()[:3], Summary: summarize(rs, unit)})
+			}
+		}
+		r.Families = append(r.Families, fr)
+	}
+	return r
+}
+
+func byFamily(results []RunResult, family string) []RunResult {
+	var rs []RunResult
+	for _, rr := range results {
+		if rr.Family == family {
+			rs = append(rs, rr)
+		}
+	}
+	return rs
+}
+
+func summarize(results []RunResult, unit string) Summary {
+	var download, upload, ping, jitter []float64
+	for _, rr := range results {
+		if rr.Download != nil {
+			download = append(download, speedtest.Convert(*rr.Download, rr.Unit, unit))
+		}
+		if rr.Upload != nil {
+			upload = append(upload, speedtest.Convert(*rr.Upload, rr.Unit, unit))
+		}
+		ping = append(ping, rr.Ping)
+		jitter = append(jitter, rr.Jitter)
+	}
+	return Summary{
+		Count:    len(results),
+		Download: newStats(download),
+		Upload:   newStats(upload),
+		Ping:     newStats(ping),
+		Jitter:   newStats(jitter),
+	}
+}
+
+func newStats(values []float64) *Stats {
+	if len(values) == 0 {
+		return nil
+	}
+	return &Stats{
+		Count:  len(values),
+		Min:    speedtest.RoundTo(slices.Min(values), 2),
+		Median: speedtest.RoundTo(speedtest.Percentile(values, 50), 2),
+		P95:    speedtest.RoundTo(speedtest.Percentile(values, 95), 2),
+		Max:    speedtest.RoundTo(slices.Max(values), 2),
+	}
+}
+
+// regressions compares the medians, a lower throughput or a higher ping and jitter is worse
+func regressions(baseline, current Summary, threshold float64) []Regression {
+	rs := []Regression{}
+	for _, m := range []struct {
+		name           string
+		baseline, curr *Stats
+		higherIsBetter bool
+	}{
+		{"download", baseline.Download, current.Download, true},
+		{"upload", baseline.Upload, current.Upload, true},
+		{"ping", baseline.Ping, current.Ping, false},
+		{"jitter", baseline.Jitter, current.Jitter, false},
+	} {
+		if m.baseline == nil || m.curr == nil || m.baseline.Median <= 0 {
+			continue
+		}
+		change := (m.curr.Median - m.baseline.Median) / m.baseline.Median
+		if (m.higherIsBetter && change < -threshold) || (!m.higherIsBetter && change > threshold) {
+			rs = append(rs, Regression{
+				Metric:   m.name,
+				Baseline: m.baseline.Median,
+				Current:  m.curr.Median,
+				Change:   speedtest.RoundTo(change, 3),
+			})
+		}
+	}
+	return rs
+}
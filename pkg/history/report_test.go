@@ -0,0 +1,143 @@
+package history
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func median(v float64) *Stats {
+	return &Stats{Count: 1, Min: v, Median: v, P95: v, Max: v}
+}
+
+func TestRegressions(t *testing.T) {
+	baseline := Summary{Download: median(100), Upload: median(50), Ping: median(10), Jitter: median(2)}
+	tests := []struct {
+		name    string
+		current Summary
+		want    []Regression
+	}{
+		{
+			name:    "unchanged",
+			current: baseline,
+			want:    []Regression{},
+		},
+		{
+			name:    "lower throughput beyond the threshold",
+			current: Summary{Download: median(70), Upload: median(50), Ping: median(10), Jitter: median(2)},
+			want:    []Regression{{Metric: "download", Baseline: 100, Current: 70, Change: -0.3}},
+		},
+		{
+			name:    "lower throughput within the threshold",
+			current: Summary{Download: median(85), Upload: median(45), Ping: median(10), Jitter: median(2)},
+			want:    []Regression{},
+		},
+		{
+			name:    "higher throughput is no regression",
+			current: Summary{Download: median(200), Upload: median(100), Ping: median(10), Jitter: median(2)},
+			want:    []Regression{},
+		},
+		{
+			name:    "higher ping and jitter beyond the threshold",
+			current: Summary{Download: median(100), Upload: median(50), Ping: median(13), Jitter: median(3)},
+			want: []Regression{
+				{Metric: "ping", Baseline: 10, Current: 13, Change: 0.3},
+				{Metric: "jitter", Baseline: 2, Current: 3, Change: 0.5},
+			},
+		},
+		{
+			name:    "lower ping is no regression",
+			current: Summary{Download: median(100), Upload: median(50), Ping: median(5), Jitter: median(1)},
+			want:    []Regression{},
+		},
+		{
+			name:    "skipped phase",
+			current: Summary{Ping: median(10), Jitter: median(2)},
+			want:    []Regression{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := regressions(baseline, tt.current, 0.2); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("regressions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegressionsZeroBaseline(t *testing.T) {
+	baseline := Summary{Jitter: median(0)}
+	current := Summary{Jitter: median(5)}
+	if got := regressions(baseline, current, 0.2); len(got) != 0 {
+		t.Errorf("regressions() = %+v, want none", got)
+	}
+}
+
+func TestNewReport(t *testing.T) {
+	rate := func(v float64) *float64 { return &v }
+	// 2025-06-01 is a Sunday
+	sunday := time.Date(2025, 6, 1, 21, 0, 0, 0, time.UTC)
+	monday := sunday.Add(24 * time.Hour)
+	tuesday := monday.Add(24*time.Hour - 12*time.Hour)
+	results := []RunResult{
+		{Family: "IPv4", Timestamp: sunday, Download: rate(100), Upload: rate(40), Ping: 10, Jitter: 1, Unit: "Mbps"},
+		{Family: "IPv4", Timestamp: monday, Download: rate(200), Upload: rate(60), Ping: 20, Jitter: 3, Unit: "Mbps"},
+		{Family: "IPv4", Timestamp: tuesday, Download: rate(25), Upload: rate(10), Ping: 30, Jitter: 5, Unit: "MB/s"},
+		{Family: "IPv6", Timestamp: sunday, Ping: 8, Jitter: 1, Unit: "Mbps"},
+	}
+	baseline := []RunResult{
+		{Family: "IPv4", Timestamp: sunday.AddDate(0, 0, -7), Download: rate(400), Upload: rate(60), Ping: 20, Jitter: 3, Unit: "Mbps"},
+	}
+
+	r := NewReport(results, baseline, "Mbps", 0.2, time.UTC)
+	if len(r.Families) != 2 {
+		t.Fatalf("got %d families, want 2", len(r.Families))
+	}
+	ipv4, ipv6 := r.Families[0], r.Families[1]
+
+	tests := []struct {
+		name      string
+		got, want any
+	}{
+		{"family", ipv4.Family, "IPv4"},
+		{"count", ipv4.Count, 3},
+		{"download converted into the unit", *ipv4.Download, Stats{Count: 3, Min: 100, Median: 200, P95: 200, Max: 200}},
+		{"by hour", groupKeys(ipv4.ByHour), []string{"09", "21"}},
+		{"by weekday monday first", groupKeys(ipv4.ByWeekday), []string{"Mon", "Tue", "Sun"}},
+		{"baseline", ipv4.Baseline.Count, 1},
+		{"regressions", ipv4.Regressions, []Regression{{Metric: "download", Baseline: 400, Current: 200, Change: -0.5}}},
+		{"skipped download", ipv6.Download, (*Stats)(nil)},
+		{"skipped upload", ipv6.Upload, (*Stats)(nil)},
+		{"no baseline", ipv6.Baseline, (*Summary)(nil)},
+		{"no regressions without baseline", ipv6.Regressions, []Regression{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Errorf("got %+v, want %+v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewReportLocation(t *testing.T) {
+	// 23:30 UTC on a Sunday is 08:30 on Monday in Tokyo
+	at := time.Date(2025, 6, 1, 23, 30, 0, 0, time.UTC)
+	tokyo := time.FixedZone("JST", 9*60*60)
+	r := NewReport([]RunResult{{Family: "IPv6", Timestamp: at, Ping: 5, Unit: "Mbps"}}, nil, "Mbps", 0.2, tokyo)
+	fr := r.Families[0]
+	if got := groupKeys(fr.ByHour); !reflect.DeepEqual(got, []string{"08"}) {
+		t.Errorf("by hour = %v, want [08]", got)
+	}
+	if got := groupKeys(fr.ByWeekday); !reflect.DeepEqual(got, []string{"Mon"}) {
+		t.Errorf("by weekday = %v, want [Mon]", got)
+	}
+}
+
+func groupKeys(groups []Group) []string {
+	var keys []string
+	for _, g := range groups {
+		keys = append(keys, g.Key)
+	}
+	return keys
+}
@@ -0,0 +1,406 @@
+package speedtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	clientTypes "github.com/inonius/v3cli/api/client"
+	"github.com/librespeed/speedtest-cli/defs"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	EngineNative     = "native"
+	EngineLibrespeed = "librespeed"
+
+	// span of the rolling estimates that have to agree in adaptive mode
+	adaptiveWindow = 2 * time.Second
+
+	// pause of a stream after a failed request, so that a server refusing connections is not hammered
+	streamRetryDelay = 200 * time.Millisecond
+)
+
+// byteCounter counts the bytes of a single HTTP stream
+type byteCounter struct {
+	total atomic.Uint64
+}
+
+// Write implements io.Writer for the download body
+func (b *byteCounter) Write(p []byte) (int, error) {
+	b.total.Add(uint64(len(p)))
+	return len(p), nil
+}
+
+// countingReader counts the bytes of the upload body as the transport reads it
+type countingReader struct {
+	r       io.Reader
+	counter *byteCounter
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.counter.total.Add(uint64(n))
+	return n, err
+}
+
+// phase is a single download or upload measurement
+type phase struct {
+	start    time.Time
+	elapsed  time.Duration
+	counters []*byteCounter
+	samples  []clientTypes.ThroughputSample
+
+	last      time.Time
+	lastBytes []uint64
+
+	// bytes transferred during the warm-up, excluded from the rate
+	warmup      time.Duration
+	warmupBytes uint64
+
+	// adaptive mode: rolling rate estimates and whether they converged before Duration
+	estimates []float64
+	converged bool
+
+	// failed requests of the streams, each retried until the end of the phase
+	errors int
+}
+
+func (p *phase) total() uint64 {
+	var total uint64
+	for _, counter := range p.counters {
+		total += counter.total.Load()
+	}
+	return total
+}
+
+// sample records the rate of every stream since the previous sample
+func (p *phase) sample(e *engine, now time.Time) {
+	dt := now.Sub(p.last)
+	s := clientTypes.ThroughputSample{
+		Time: RoundTo(now.Sub(p.start).Seconds(), 3),
+	}
+	var delta uint64
+	for i, counter := range p.counters {
+		total := counter.total.Load()
+		s.Streams = append(s.Streams, RoundTo(e.rate(total-p.lastBytes[i], dt), 2))
+		delta += total - p.lastBytes[i]
+		p.lastBytes[i] = total
+	}
+	s.Rate = RoundTo(e.rate(delta, dt), 2)
+	p.samples = append(p.samples, s)
+	p.last = now
+}
+
+// rate is the throughput after the warm-up
+func (p *phase) rate(e *engine) float64 {
+	return e.rate(p.total()-p.warmupBytes, p.elapsed-p.warmup)
+}
+
+// converge keeps the rolling rate after the warm-up and reports whether the last
+// adaptiveWindow of estimates stayed within Tolerance
+func (p *phase) converge(e *engine, now time.Time) bool {
+	p.estimates = append(p.estimates, e.rate(p.total()-p.warmupBytes, now.Sub(p.start)-p.warmup))
+	if now.Sub(p.start) < e.c.Config.MinDuration {
+		return false
+	}
+
+	// n estimates span n-1 intervals
+	window := int(math.Ceil(float64(adaptiveWindow)/float64(e.sampleInterval()))) + 1
+	window = max(window, 3)
+	if len(p.estimates) < window {
+		return false
+	}
+	last := p.estimates[len(p.estimates)-window:]
+	latest := last[len(last)-1]
+	if latest <= 0 {
+		return false
+	}
+	return (slices.Max(last)-slices.Min(last))/latest <= e.c.Config.Tolerance
+}
+
+// detail converts the phase into the per-stream detail kept in the result
+func (p *phase) detail() *clientTypes.PhaseDetail {
+	// a sample is measured when most of its interval is after the warm-up, the ticker and the warm-up timer drift apart
+	var measured []clientTypes.ThroughputSample
+	var previous float64
+	for _, sample := range p.samples {
+		if (previous+sample.Time)/2 > p.warmup.Seconds() {
+			measured = append(measured, sample)
+		}
+		previous = sample.Time
+	}
+	d := &clientTypes.PhaseDetail{
+		Elapsed:     RoundTo(p.elapsed.Seconds(), 3),
+		Warmup:      RoundTo(p.warmup.Seconds(), 3),
+		WarmupBytes: p.warmupBytes,
+		Samples:     p.samples,
+		Stats:       throughputStats(measured),
+		Adaptive:    p.estimates != nil,
+		Converged:   p.converged,
+		Errors:      p.errors,
+	}
+	for _, counter := range p.counters {
+		d.StreamBytes = append(d.StreamBytes, counter.total.Load())
+	}
+	return d
+}
+
+// engine measures throughput against the librespeed garbage.php/empty.php endpoints
+// with the client's own transport, instead of http.DefaultClient used by defs.Server
+type engine struct {
+	c       clientTypes.Client
+	client  *http.Client
+	server  defs.Server
+	payload []byte
+}
+
+func newEngine(c clientTypes.Client, transport *http.Transport, server defs.Server) *engine {
+	transport = transport.Clone()
+	// keep one connection per stream
+	transport.MaxIdleConnsPerHost = c.Config.Concurrent
+	transport.DisableCompression = true
+
+	return &engine{
+		c:      c,
+		client: &http.Client{Transport: transport},
+		server: server,
+	}
+}
+
+func (e *engine) url(p string) (*url.URL, error) {
+	u, err := e.server.GetURL()
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path.Join(u.Path, p)
+	return u, nil
+}
+
+func (e *engine) rate(bytes uint64, elapsed time.Duration) float64 {
+	return throughput(e.c, bytes, elapsed)
+}
+
+// throughput converts bytes over elapsed into Mbps (Mibps with MebiBytes) and then into Unit
+func throughput(c clientTypes.Client, bytes uint64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	var base float64 = 125000
+	if c.Config.MebiBytes {
+		base = 131072
+	}
+	return convertUnit(c, float64(bytes)/elapsed.Seconds()/base)
+}
+
+func (e *engine) sampleInterval() time.Duration {
+	if e.c.Config.SampleInterval > 0 {
+		return e.c.Config.SampleInterval
+	}
+	return time.Second
+}
+
+// run starts Concurrent streams and stops them after Duration, the first Warmup of it is not rated.
+// A failed request is retried after streamRetryDelay, so that a transient error does not stop the stream.
+// In adaptive mode the streams are stopped as soon as the rate converges.
+func (e *engine) run(ctx context.Context, name string, stream func(ctx context.Context, counter *byteCounter) error) (*phase, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(e.c.Config.Duration)*time.Second)
+	defer cancel()
+
+	p := &phase{start: time.Now()}
+	errs := make([]error, e.c.Config.Concurrent)
+	errCounts := make([]int, e.c.Config.Concurrent)
+
+	var wg sync.WaitGroup
+	for i := 0; i < e.c.Config.Concurrent; i++ {
+		counter := &byteCounter{}
+		p.counters = append(p.counters, counter)
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				err := stream(ctx, counter)
+				if err == nil || ctx.Err() != nil {
+					continue
+				}
+				log.Debugf("%s stream %d failed: %s", name, i, err)
+				errs[i] = err
+				errCounts[i]++
+				select {
+				case <-ctx.Done():
+				case <-time.After(streamRetryDelay):
+				}
+			}
+		}(i)
+	}
+
+	// snapshot the bytes at the end of the warm-up
+	warmedUp := make(chan struct{})
+	warmupTimer := time.AfterFunc(e.c.Config.Warmup, func() {
+		defer close(warmedUp)
+		p.warmup = time.Since(p.start)
+		p.warmupBytes = p.total()
+	})
+
+	// sample every SampleInterval until the streams are stopped
+	interval := e.sampleInterval()
+	p.last = p.start
+	p.lastBytes = make([]uint64, len(p.counters))
+	streamsDone := make(chan struct{})
+	samplerDone := make(chan struct{})
+	go func() {
+		defer close(samplerDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				p.sample(e, now)
+				if !e.c.Config.Adaptive {
+					continue
+				}
+				select {
+				case <-warmedUp:
+				default:
+					continue
+				}
+				if p.converge(e, now) {
+					p.converged = true
+					cancel()
+				}
+			case <-streamsDone:
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(streamsDone)
+	<-samplerDone
+	if !warmupTimer.Stop() {
+		<-warmedUp
+	}
+	now := time.Now()
+	p.elapsed = now.Sub(p.start)
+	// keep the trailing partial interval only if it is long enough to be meaningful
+	if now.Sub(p.last) >= interval/2 {
+		p.sample(e, now)
+	}
+
+	if p.total() == 0 {
+		if err := errors.Join(errs...); err != nil {
+			return p, err
+		}
+		return p, fmt.Errorf("no data transferred")
+	}
+	var last error
+	for i, n := range errCounts {
+		p.errors += n
+		if errs[i] != nil {
+			last = errs[i]
+		}
+	}
+	if p.errors > 0 {
+		log.Warnf("%d %s requests failed and were retried, the throughput may be lower, last error: %s", p.errors, name, last)
+	}
+	return p, nil
+}
+
+// Download fetches garbage.php on every stream until Duration elapses
+func (e *engine) Download(ctx context.Context) (float64, uint64, *clientTypes.PhaseDetail, error) {
+	u, err := e.url(e.server.DownloadURL)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	q := u.Query()
+	q.Set("ckSize", strconv.Itoa(e.c.Config.Chunks))
+	u.RawQuery = q.Encode()
+
+	p, err := e.run(ctx, "download", func(ctx context.Context, counter *byteCounter) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("User-Agent", defs.UserAgent)
+		req.Header.Set("Accept-Encoding", "identity")
+
+		resp, err := e.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected status %s", resp.Status)
+		}
+
+		_, err = io.Copy(counter, resp.Body)
+		return err
+	})
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	return p.rate(e), p.total(), p.detail(), nil
+}
+
+// Upload posts UploadSize KiB payloads to empty.php on every stream until Duration elapses
+func (e *engine) Upload(ctx context.Context) (float64, uint64, *clientTypes.PhaseDetail, error) {
+	u, err := e.url(e.server.UploadURL)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	size := int64(e.c.Config.UploadSize) * 1024
+	if !e.c.Config.NoPreAllocate && e.payload == nil {
+		e.payload = make([]byte, size)
+		if _, err := rand.Read(e.payload); err != nil {
+			return 0, 0, nil, err
+		}
+	}
+
+	p, err := e.run(ctx, "upload", func(ctx context.Context, counter *byteCounter) error {
+		var body io.Reader
+		if e.payload != nil {
+			body = bytes.NewReader(e.payload)
+		} else {
+			body = io.LimitReader(rand.Reader, size)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), &countingReader{r: body, counter: counter})
+		if err != nil {
+			return err
+		}
+		req.ContentLength = size
+		req.Header.Set("User-Agent", defs.UserAgent)
+		req.Header.Set("Content-Type", "application/octet-stream")
+
+		resp, err := e.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	return p.rate(e), p.total(), p.detail(), nil
+}
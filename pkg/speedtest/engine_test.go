@@ -0,0 +1,166 @@
+package speedtest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	clientTypes "github.com/inonius/v3cli/api/client"
+	"github.com/librespeed/speedtest-cli/defs"
+)
+
+func TestDownloadRetriesFailedRequests(t *testing.T) {
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first request of every stream fails
+		if requests.Add(1) <= 2 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(make([]byte, 64<<10))
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	c := clientTypes.Client{Config: &clientTypes.Config{Concurrent: 2, Duration: 1, Chunks: 1, SampleInterval: 100 * time.Millisecond}}
+	e := newEngine(c, http.DefaultTransport.(*http.Transport), defs.Server{Server: ts.URL + "/", DownloadURL: "garbage.php"})
+	_, total, detail, err := e.Download(context.Background())
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if total == 0 {
+		t.Errorf("no data transferred")
+	}
+	if detail.Errors != 2 {
+		t.Errorf("got %d errors, want 2", detail.Errors)
+	}
+	for i, n := range detail.StreamBytes {
+		if n == 0 {
+			t.Errorf("stream %d stopped after its failed request", i)
+		}
+	}
+}
+
+func TestDownloadFailsWithoutData(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	c := clientTypes.Client{Config: &clientTypes.Config{Concurrent: 2, Duration: 1, Chunks: 1}}
+	e := newEngine(c, http.DefaultTransport.(*http.Transport), defs.Server{Server: ts.URL + "/", DownloadURL: "garbage.php"})
+	if _, _, _, err := e.Download(context.Background()); err == nil {
+		t.Errorf("Download() succeeded without any data")
+	}
+}
+
+func TestPhaseRateExcludesWarmup(t *testing.T) {
+	counter := &byteCounter{}
+	counter.total.Store(2500000)
+	p := &phase{counters: []*byteCounter{counter}, elapsed: 3 * time.Second, warmup: time.Second, warmupBytes: 500000}
+	e := &engine{c: clientTypes.Client{Config: &clientTypes.Config{}}}
+	// 2MB over the 2s after the warm-up
+	if got := p.rate(e); got != 8 {
+		t.Errorf("rate() = %v, want 8", got)
+	}
+}
+
+func TestPhaseDetailExcludesWarmupSamples(t *testing.T) {
+	tests := []struct {
+		name   string
+		warmup time.Duration
+		times  []float64
+		want   *clientTypes.ThroughputStats
+	}{
+		{
+			name:  "no warm-up",
+			times: []float64{1, 2, 3},
+			want:  &clientTypes.ThroughputStats{Peak: 100, Median: 20, P10: 12, P90: 84, Stability: 0.071},
+		},
+		{
+			name:   "aligned",
+			warmup: time.Second,
+			times:  []float64{1, 2, 3},
+			want:   &clientTypes.ThroughputStats{Peak: 20, Median: 15, P10: 11, P90: 19, Stability: 0.667},
+		},
+		{
+			name:   "ticker after the warm-up timer",
+			warmup: 1000300 * time.Microsecond,
+			times:  []float64{1.001, 2.001, 3.001},
+			want:   &clientTypes.ThroughputStats{Peak: 20, Median: 15, P10: 11, P90: 19, Stability: 0.667},
+		},
+		{
+			name:   "ticker before the warm-up timer",
+			warmup: 1000300 * time.Microsecond,
+			times:  []float64{0.999, 1.999, 2.999},
+			want:   &clientTypes.ThroughputStats{Peak: 20, Median: 15, P10: 11, P90: 19, Stability: 0.667},
+		},
+		{
+			name:   "warm-up longer than the phase",
+			warmup: 5 * time.Second,
+			times:  []float64{1, 2, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &phase{warmup: tt.warmup, warmupBytes: 1000}
+			for i, rate := range []float64{100, 10, 20} {
+				p.samples = append(p.samples, clientTypes.ThroughputSample{Time: tt.times[i], Rate: rate})
+			}
+			d := p.detail()
+			if !reflect.DeepEqual(d.Stats, tt.want) {
+				t.Errorf("Stats = %+v, want %+v", d.Stats, tt.want)
+			}
+			if len(d.Samples) != 3 || d.WarmupBytes != 1000 {
+				t.Errorf("the warm-up samples and bytes are not kept in the detail: %+v", d)
+			}
+		})
+	}
+}
+
+// convergedAt feeds one rolling rate estimate (Mbps) per interval to converge and returns the first converged tick, 0 if none
+func convergedAt(estimates []float64, interval, minDuration time.Duration, tolerance float64) int {
+	e := &engine{c: clientTypes.Client{Config: &clientTypes.Config{SampleInterval: interval, MinDuration: minDuration, Tolerance: tolerance}}}
+	start := time.Now()
+	counter := &byteCounter{}
+	p := &phase{start: start, counters: []*byteCounter{counter}}
+	for i, estimate := range estimates {
+		elapsed := time.Duration(i+1) * interval
+		counter.total.Store(uint64(estimate * 125000 * elapsed.Seconds()))
+		if p.converge(e, start.Add(elapsed)) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func TestConverge(t *testing.T) {
+	flat := []float64{100, 100, 100, 100, 100, 100, 100, 100, 100, 100}
+	tests := []struct {
+		name        string
+		estimates   []float64
+		interval    time.Duration
+		minDuration time.Duration
+		want        int
+	}{
+		{"flat, 2s of 1s intervals", flat, time.Second, 0, 3},
+		{"flat, 2s of 500ms intervals", flat, 500 * time.Millisecond, 0, 5},
+		{"flat, 3 estimates at least", flat, 2 * time.Second, 0, 3},
+		{"flat, not before the min duration", flat, time.Second, 5 * time.Second, 5},
+		{"slow start", []float64{50, 80, 100, 100, 100, 100}, time.Second, 0, 5},
+		{"within the tolerance", []float64{100, 104, 102}, time.Second, 0, 3},
+		{"beyond the tolerance", []float64{100, 110, 105, 120, 90, 100}, time.Second, 0, 0},
+		{"no throughput", []float64{0, 0, 0, 0}, time.Second, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := convergedAt(tt.estimates, tt.interval, tt.minDuration, 0.05); got != tt.want {
+				t.Errorf("converged at tick %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package speedtest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"path"
+	"slices"
+	"sync"
+	"time"
+
+	clientTypes "github.com/inonius/v3cli/api/client"
+	"github.com/librespeed/speedtest-cli/defs"
+)
+
+const (
+	// idle probes taken before the download to get a baseline comparable to the loaded ones
+	idleProbeCount = 10
+	// interval between latency probes while the link is loaded
+	loadedProbeInterval = 250 * time.Millisecond
+	// a probe taking longer is abandoned, under load it is recorded as this RTT
+	probeTimeout = 5 * time.Second
+)
+
+// latencyProber measures HTTP RTT to the ping URL on a connection of its own,
+// so that the probes are not queued behind the throughput streams
+type latencyProber struct {
+	client *http.Client
+	url    string
+}
+
+func newLatencyProber(transport *http.Transport, server defs.Server) (*latencyProber, error) {
+	u, err := server.GetURL()
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path.Join(u.Path, server.PingURL)
+
+	return &latencyProber{
+		client: &http.Client{Transport: transport.Clone(), Timeout: probeTimeout},
+		url:    u.String(),
+	}, nil
+}
+
+// probe returns the RTT of a single request in ms
+func (l *latencyProber) probe(ctx context.Context) (float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", defs.UserAgent)
+
+	start := time.Now()
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return float64(time.Since(start).Microseconds()) / 1000, nil
+}
+
+// idle returns the RTTs of idleProbeCount probes, the first one is discarded due to the handshake
+func (l *latencyProber) idle(ctx context.Context) ([]float64, error) {
+	var rtts []float64
+	for i := 0; i < idleProbeCount+1; i++ {
+		rtt, err := l.probe(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			rtts = append(rtts, rtt)
+		}
+	}
+	return rtts, nil
+}
+
+// loadedProbes are the probes taken under load, a timed out probe is recorded as probeTimeout,
+// other failures are only counted as lost, so that the worst bufferbloat is not left out
+type loadedProbes struct {
+	rtts []float64
+	lost int
+}
+
+// start probes every loadedProbeInterval until the returned stop function is called
+func (l *latencyProber) start(ctx context.Context) (stop func() loadedProbes) {
+	ctx, cancel := context.WithCancel(ctx)
+	var probes loadedProbes
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(loadedProbeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				rtt, err := l.probe(ctx)
+				var netErr net.Error
+				switch {
+				case err == nil:
+					probes.rtts = append(probes.rtts, rtt)
+				case ctx.Err() != nil:
+					// stopped, not lost
+				case errors.As(err, &netErr) && netErr.Timeout():
+					probes.rtts = append(probes.rtts, float64(probeTimeout.Milliseconds()))
+					probes.lost++
+				default:
+					probes.lost++
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return func() loadedProbes {
+		cancel()
+		wg.Wait()
+		return probes
+	}
+}
+
+// BufferbloatGrade grades the RTT increase under load in ms, following the common A+ to F scale
+func BufferbloatGrade(delta float64) string {
+	switch {
+	case delta < 5:
+		return "A+"
+	case delta < 30:
+		return "A"
+	case delta < 60:
+		return "B"
+	case delta < 200:
+		return "C"
+	case delta < 400:
+		return "D"
+	default:
+		return "F"
+	}
+}
+
+// loadedLatency compares the probes taken under load to the idle RTT, the timed out ones included
+func loadedLatency(idle float64, probes loadedProbes) *clientTypes.LoadedLatency {
+	if len(probes.rtts) == 0 {
+		if probes.lost == 0 {
+			return nil
+		}
+		// every probe failed, the link is unusable under load
+		return &clientTypes.LoadedLatency{Grade: BufferbloatGrade(math.Inf(1)), Lost: probes.lost}
+	}
+	rtt := Percentile(probes.rtts, 50)
+	delta := math.Max(0, rtt-idle)
+	return &clientTypes.LoadedLatency{
+		RTT:    RoundTo(rtt, 2),
+		Delta:  RoundTo(delta, 2),
+		Grade:  BufferbloatGrade(delta),
+		Probes: len(probes.rtts),
+		Lost:   probes.lost,
+	}
+}
+
+// bufferbloat builds the result from the idle and loaded probes, the overall grade is the worst direction
+func bufferbloat(idleRTTs []float64, download, upload loadedProbes) *clientTypes.Bufferbloat {
+	idle := Percentile(idleRTTs, 50)
+	b := &clientTypes.Bufferbloat{
+		IdleRTT:  RoundTo(idle, 2),
+		Download: loadedLatency(idle, download),
+		Upload:   loadedLatency(idle, upload),
+	}
+	if b.Download == nil && b.Upload == nil {
+		return nil
+	}
+	b.Grade = worseGrade(b.Download, b.Upload)
+	return b
+}
+
+// worseGrade is the worst grade of the directions measured
+func worseGrade(latencies ...*clientTypes.LoadedLatency) string {
+	grades := []string{"A+", "A", "B", "C", "D", "F"}
+	worst := 0
+	for _, l := range latencies {
+		if l != nil {
+			worst = max(worst, slices.Index(grades, l.Grade))
+		}
+	}
+	return grades[worst]
+}
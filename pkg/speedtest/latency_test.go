@@ -0,0 +1,178 @@
+package speedtest
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	clientTypes "github.com/inonius/v3cli/api/client"
+)
+
+func TestBufferbloatGrade(t *testing.T) {
+	tests := []struct {
+		delta float64
+		want  string
+	}{
+		{0, "A+"},
+		{4.99, "A+"},
+		{5, "A"},
+		{29.99, "A"},
+		{30, "B"},
+		{59.99, "B"},
+		{60, "C"},
+		{199.99, "C"},
+		{200, "D"},
+		{399.99, "D"},
+		{400, "F"},
+		{math.Inf(1), "F"},
+	}
+	for _, tt := range tests {
+		if got := BufferbloatGrade(tt.delta); got != tt.want {
+			t.Errorf("BufferbloatGrade(%v) = %s, want %s", tt.delta, got, tt.want)
+		}
+	}
+}
+
+func TestWorseGrade(t *testing.T) {
+	tests := []struct {
+		name             string
+		download, upload *clientTypes.LoadedLatency
+		want             string
+	}{
+		{"upload worse", &clientTypes.LoadedLatency{Grade: "A"}, &clientTypes.LoadedLatency{Grade: "C"}, "C"},
+		{"download worse", &clientTypes.LoadedLatency{Grade: "F"}, &clientTypes.LoadedLatency{Grade: "A+"}, "F"},
+		{"download only", &clientTypes.LoadedLatency{Grade: "B"}, nil, "B"},
+		{"upload only", nil, &clientTypes.LoadedLatency{Grade: "D"}, "D"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := worseGrade(tt.download, tt.upload); got != tt.want {
+				t.Errorf("worseGrade() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadedLatency(t *testing.T) {
+	timedOut := float64(probeTimeout.Milliseconds())
+	tests := []struct {
+		name   string
+		probes loadedProbes
+		want   *clientTypes.LoadedLatency
+	}{
+		{
+			name:   "no probe",
+			probes: loadedProbes{},
+		},
+		{
+			name:   "every probe lost",
+			probes: loadedProbes{lost: 4},
+			want:   &clientTypes.LoadedLatency{Grade: "F", Lost: 4},
+		},
+		{
+			name:   "median of the probes",
+			probes: loadedProbes{rtts: []float64{20, 45, 22}},
+			want:   &clientTypes.LoadedLatency{RTT: 22, Delta: 12, Grade: "A", Probes: 3},
+		},
+		{
+			name:   "a timed out probe counts as the timeout and as lost",
+			probes: loadedProbes{rtts: []float64{20, timedOut, 22}, lost: 1},
+			want:   &clientTypes.LoadedLatency{RTT: 22, Delta: 12, Grade: "A", Probes: 3, Lost: 1},
+		},
+		{
+			name:   "mostly timed out",
+			probes: loadedProbes{rtts: []float64{timedOut, 20, timedOut}, lost: 3},
+			want:   &clientTypes.LoadedLatency{RTT: timedOut, Delta: timedOut - 10, Grade: "F", Probes: 3, Lost: 3},
+		},
+		{
+			name:   "faster than idle",
+			probes: loadedProbes{rtts: []float64{8, 9}},
+			want:   &clientTypes.LoadedLatency{RTT: 8.5, Delta: 0, Grade: "A+", Probes: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := loadedLatency(10, tt.probes); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadedLatency() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBufferbloat(t *testing.T) {
+	idle := []float64{10, 12, 11}
+	if got := bufferbloat(idle, loadedProbes{}, loadedProbes{}); got != nil {
+		t.Errorf("bufferbloat() without probes = %+v, want nil", got)
+	}
+	got := bufferbloat(idle, loadedProbes{rtts: []float64{50}}, loadedProbes{})
+	want := &clientTypes.Bufferbloat{
+		IdleRTT:  11,
+		Download: &clientTypes.LoadedLatency{RTT: 50, Delta: 39, Grade: "B", Probes: 1},
+		Grade:    "B",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("bufferbloat() = %+v, want %+v", got, want)
+	}
+}
+
+func TestLoadedProbesTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer fast.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := "http://" + ln.Addr().String()
+	ln.Close()
+
+	tests := []struct {
+		name             string
+		url              string
+		timedOut, failed bool
+	}{
+		{"answered", fast.URL, false, false},
+		{"timed out", slow.URL, true, false},
+		{"refused", refused, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &latencyProber{client: &http.Client{Timeout: 50 * time.Millisecond}, url: tt.url}
+			stop := l.start(context.Background())
+			time.Sleep(3*loadedProbeInterval + loadedProbeInterval/2)
+			probes := stop()
+
+			if len(probes.rtts)+probes.lost == 0 {
+				t.Fatalf("no probe taken")
+			}
+			timeouts := 0
+			for _, rtt := range probes.rtts {
+				if rtt == float64(probeTimeout.Milliseconds()) {
+					timeouts++
+				}
+			}
+			switch {
+			case tt.timedOut:
+				if timeouts == 0 || timeouts != len(probes.rtts) || probes.lost != timeouts {
+					t.Errorf("timed out probes are not recorded as the timeout and lost: %+v", probes)
+				}
+			case tt.failed:
+				if len(probes.rtts) != 0 || probes.lost == 0 {
+					t.Errorf("failed probes are not only counted as lost: %+v", probes)
+				}
+			default:
+				if timeouts != 0 || probes.lost != 0 {
+					t.Errorf("answered probes are lost: %+v", probes)
+				}
+			}
+		})
+	}
+}
@@ -25,7 +25,7 @@ const (
 )
 
 // doSpeedTest is where the actual speed test happens
-func doSpeedTest(c clientTypes.Client, ctx *context.Context, logger *slog.Logger, servers []defs.Server, network string, silent bool, noICMP bool) (*clientTypes.SpeedtestResult, error) {
+func doSpeedTest(c clientTypes.Client, ctx *context.Context, logger *slog.Logger, servers []defs.Server, transport *http.Transport, network string, silent bool, noICMP bool) (*clientTypes.SpeedtestResult, error) {
 	if serverCount := len(servers); serverCount > 1 {
 		logger.Info("Testing agains", "ServerCount", &serverCount)
 	}
@@ -59,33 +59,99 @@ func doSpeedTest(c clientTypes.Client, ctx *context.Context, logger *slog.Logger
 			logger.Info(fmt.Sprint("RTT ", RoundTo(p, 3), "ms"))
 			logger.Info(fmt.Sprint("Jitter ", RoundTo(jitter, 3), "ms"))
 
+			nativeEngine := newEngine(c, transport, currentServer)
+			var downloadDetail, uploadDetail *clientTypes.PhaseDetail
+
+			// latency under load, the idle baseline is taken with the same prober
+			var prober *latencyProber
+			var idleRTTs []float64
+			var downloadProbes, uploadProbes loadedProbes
+			if !c.Config.NoBufferbloat && !(c.Config.NoDownload && c.Config.NoUpload) {
+				prober, err = newLatencyProber(transport, currentServer)
+				if err == nil {
+					idleRTTs, err = prober.idle(*ctx)
+				}
+				if err != nil {
+					logger.Error("Failed to get idle RTT, skipping latency under load:", "error", err)
+					prober = nil
+				}
+			}
+
 			// get download value
 			var downloadValue float64
 			var bytesRead uint64
-			logger.Info("Download testing.... ")
-
-			download, br, err := currentServer.Download(silent, c.Config.Bytes, c.Config.MebiBytes, c.Config.Concurrent, c.Config.Chunks, time.Duration(c.Config.Duration*time.Second))
-			if err != nil {
-				logger.Error("Failed to get download speed:", "error", err)
-				return nil, err
+			if c.Config.NoDownload {
+				logger.Info("Download skipped")
+			} else {
+				logger.Info("Download testing.... ")
+
+				downloadProbes, err = measureUnderLoad(*ctx, prober, func() error {
+					if c.Config.Engine == EngineLibrespeed {
+						download, br, err := currentServer.Download(silent, c.Config.Bytes, c.Config.MebiBytes, c.Config.Concurrent, c.Config.Chunks, time.Duration(c.Config.Duration*time.Second))
+						if err != nil {
+							return err
+						}
+						downloadValue = convertUnit(c, download)
+						bytesRead = uint64(br)
+						return nil
+					}
+					download, br, detail, err := nativeEngine.Download(*ctx)
+					if err != nil {
+						return err
+					}
+					downloadValue = download
+					bytesRead = br
+					downloadDetail = detail
+					return nil
+				})
+				if err != nil {
+					logger.Error("Failed to get download speed:", "error", err)
+					return nil, err
+				}
+				logger.Info(fmt.Sprint("Download ", RoundTo(downloadValue, 2), Unit(*c.Config)))
+				logStats(logger, "Download", downloadDetail, Unit(*c.Config))
 			}
-			downloadValue = download
-			bytesRead = uint64(br)
-			logger.Info(fmt.Sprint("Download ", RoundTo(downloadValue, 2), "Mbps"))
 
 			// get upload value
 			var uploadValue float64
 			var bytesWritten uint64
-			logger.Info("Upload testing.... ")
+			if c.Config.NoUpload {
+				logger.Info("Upload skipped")
+			} else {
+				logger.Info("Upload testing.... ")
+
+				uploadProbes, err = measureUnderLoad(*ctx, prober, func() error {
+					if c.Config.Engine == EngineLibrespeed {
+						upload, bw, err := currentServer.Upload(c.Config.NoPreAllocate, silent, c.Config.Bytes, c.Config.MebiBytes, c.Config.Concurrent, c.Config.UploadSize, time.Duration(c.Config.Duration*time.Second))
+						if err != nil {
+							return err
+						}
+						uploadValue = convertUnit(c, upload)
+						bytesWritten = uint64(bw)
+						return nil
+					}
+					upload, bw, detail, err := nativeEngine.Upload(*ctx)
+					if err != nil {
+						return err
+					}
+					uploadValue = upload
+					bytesWritten = bw
+					uploadDetail = detail
+					return nil
+				})
+				if err != nil {
+					logger.Error("Failed to get upload speed:", "error", err)
+					return nil, err
+				}
+				logger.Info(fmt.Sprint("Upload ", RoundTo(uploadValue, 2), Unit(*c.Config)))
+				logStats(logger, "Upload", uploadDetail, Unit(*c.Config))
+			}
 
-			upload, bw, err := currentServer.Upload(c.Config.NoPreAllocate, silent, c.Config.Bytes, c.Config.MebiBytes, c.Config.Concurrent, c.Config.UploadSize, time.Duration(c.Config.Duration*time.Second))
-			if err != nil {
-				logger.Error("Failed to get upload speed:", "error", err)
-				return nil, err
+			var bloat *clientTypes.Bufferbloat
+			if prober != nil {
+				bloat = bufferbloat(idleRTTs, downloadProbes, uploadProbes)
+				logBufferbloat(logger, bloat)
 			}
-			uploadValue = upload
-			bytesWritten = uint64(bw)
-			logger.Info(fmt.Sprint("Upload ", RoundTo(uploadValue, 2), "Mbps"))
 
 			var librespeedTestID string
 			var extra defs.TelemetryExtra
@@ -95,7 +161,18 @@ func doSpeedTest(c clientTypes.Client, ctx *context.Context, logger *slog.Logger
 			telemetryServer.Server = currentServer.Server
 			telemetryServer.Path = "/results/telemetry.php"
 
-			id, err := sendTelemetry(telemetryServer, downloadValue, uploadValue, p, jitter, currentServer.TLog.String(), extra)
+			// the telemetry backend stores Mbps whatever the unit of the result, a skipped phase is left out rather than sent as 0
+			unit := Unit(*c.Config)
+			var telemetryDownload, telemetryUpload *float64
+			if !c.Config.NoDownload {
+				mbps := BitsPerSecond(unit, downloadValue) / 1e6
+				telemetryDownload = &mbps
+			}
+			if !c.Config.NoUpload {
+				mbps := BitsPerSecond(unit, uploadValue) / 1e6
+				telemetryUpload = &mbps
+			}
+			id, err := sendTelemetry(telemetryServer, telemetryDownload, telemetryUpload, p, jitter, currentServer.TLog.String(), extra)
 			if err != nil {
 				logger.Error("Error when sending telemetry data:", "error", err)
 				return nil, err
@@ -117,6 +194,12 @@ func doSpeedTest(c clientTypes.Client, ctx *context.Context, logger *slog.Logger
 			rep.BytesSent = bytesWritten
 			rep.Share = ""
 			rep.ID = &librespeedTestID
+			rep.DownloadSkipped = c.Config.NoDownload
+			rep.UploadSkipped = c.Config.NoUpload
+			rep.Engine = c.Config.Engine
+			rep.DownloadDetail = downloadDetail
+			rep.UploadDetail = uploadDetail
+			rep.Bufferbloat = bloat
 			return &rep, nil
 
 		} else {
@@ -127,8 +210,8 @@ func doSpeedTest(c clientTypes.Client, ctx *context.Context, logger *slog.Logger
 	return nil, nil
 }
 
-// sendTelemetry omit ispInfo from original code
-func sendTelemetry(telemetryServer defs.TelemetryServer, download, upload, pingVal, jitter float64, logs string, extra defs.TelemetryExtra) (string, error) {
+// sendTelemetry omit ispInfo from original code, a nil download or upload (skipped phase) is not sent
+func sendTelemetry(telemetryServer defs.TelemetryServer, download, upload *float64, pingVal, jitter float64, logs string, extra defs.TelemetryExtra) (string, error) {
 	var buf bytes.Buffer
 	wr := multipart.NewWriter(&buf)
 
@@ -140,20 +223,24 @@ func sendTelemetry(telemetryServer defs.TelemetryServer, download, upload, pingV
 		return "", err
 	}
 
-	if fDownload, err := wr.CreateFormField("dl"); err != nil {
-		log.Debugf("Error creating form field: %s", err)
-		return "", err
-	} else if _, err = fDownload.Write([]byte(strconv.FormatFloat(download, 'f', 2, 64))); err != nil {
-		log.Debugf("Error writing form field: %s", err)
-		return "", err
+	if download != nil {
+		if fDownload, err := wr.CreateFormField("dl"); err != nil {
+			log.Debugf("Error creating form field: %s", err)
+			return "", err
+		} else if _, err = fDownload.Write([]byte(strconv.FormatFloat(*download, 'f', 2, 64))); err != nil {
+			log.Debugf("Error writing form field: %s", err)
+			return "", err
+		}
 	}
 
-	if fUpload, err := wr.CreateFormField("ul"); err != nil {
-		log.Debugf("Error creating form field: %s", err)
-		return "", err
-	} else if _, err = fUpload.Write([]byte(strconv.FormatFloat(upload, 'f', 2, 64))); err != nil {
-		log.Debugf("Error writing form field: %s", err)
-		return "", err
+	if upload != nil {
+		if fUpload, err := wr.CreateFormField("ul"); err != nil {
+			log.Debugf("Error creating form field: %s", err)
+			return "", err
+		} else if _, err = fUpload.Write([]byte(strconv.FormatFloat(*upload, 'f', 2, 64))); err != nil {
+			log.Debugf("Error writing form field: %s", err)
+			return "", err
+		}
 	}
 
 	if fPing, err := wr.CreateFormField("ping"); err != nil {
@@ -226,6 +313,101 @@ func sendTelemetry(telemetryServer defs.TelemetryServer, download, upload, pingV
 	}
 }
 
+// measureUnderLoad runs a download or upload while probing the latency, if enabled
+func measureUnderLoad(ctx context.Context, prober *latencyProber, measure func() error) (loadedProbes, error) {
+	if prober == nil {
+		return loadedProbes{}, measure()
+	}
+	stop := prober.start(ctx)
+	err := measure()
+	return stop(), err
+}
+
+// logBufferbloat prints the idle and loaded RTT
+func logBufferbloat(logger *slog.Logger, b *clientTypes.Bufferbloat) {
+	if b == nil {
+		return
+	}
+	logger.Info(fmt.Sprint("Idle RTT ", b.IdleRTT, "ms"))
+	for _, l := range []struct {
+		direction string
+		latency   *clientTypes.LoadedLatency
+	}{{"download", b.Download}, {"upload", b.Upload}} {
+		if l.latency == nil {
+			continue
+		}
+		line := fmt.Sprintf("Loaded RTT (%s) %.2fms, +%.2fms, grade %s", l.direction, l.latency.RTT, l.latency.Delta, l.latency.Grade)
+		if l.latency.Lost > 0 {
+			line += fmt.Sprintf(", %d probes lost", l.latency.Lost)
+		}
+		logger.Info(line)
+	}
+	logger.Info(fmt.Sprint("Bufferbloat grade ", b.Grade))
+}
+
+// logStats prints the sample statistics of the native engine
+func logStats(logger *slog.Logger, direction string, detail *clientTypes.PhaseDetail, unit string) {
+	if detail == nil || detail.Stats == nil {
+		return
+	}
+	if detail.Adaptive {
+		if detail.Converged {
+			logger.Info(fmt.Sprintf("%s converged after %.2fs", direction, detail.Elapsed))
+		} else {
+			logger.Info(fmt.Sprintf("%s did not converge, stopped at the max duration", direction))
+		}
+	}
+	if detail.Warmup > 0 {
+		logger.Info(fmt.Sprintf("%s warm-up of %.2fs excluded (%d bytes)", direction, detail.Warmup, detail.WarmupBytes))
+	}
+	logger.Info(fmt.Sprintf("%s peak %.2f / median %.2f / p10 %.2f / p90 %.2f %s, stability %.2f",
+		direction, detail.Stats.Peak, detail.Stats.Median, detail.Stats.P10, detail.Stats.P90, unit, detail.Stats.Stability))
+}
+
+// Unit is the unit of the reported throughput, following --bytes and --mebibytes
+func Unit(c clientTypes.Config) string {
+	switch {
+	case c.Bytes && c.MebiBytes:
+		return "MiB/s"
+	case c.Bytes:
+		return "MB/s"
+	case c.MebiBytes:
+		return "Mibps"
+	default:
+		return "Mbps"
+	}
+}
+
+// BitsPerSecond converts a rate reported in unit (see: Unit) back into bits per second
+func BitsPerSecond(unit string, v float64) float64 {
+	switch unit {
+	case "MiB/s":
+		return v * 8 * (1 << 20)
+	case "MB/s":
+		return v * 8e6
+	case "Mibps":
+		return v * (1 << 20)
+	default:
+		return v * 1e6
+	}
+}
+
+// Convert converts a rate between the units of Unit
+func Convert(v float64, from, to string) float64 {
+	if from == to {
+		return v
+	}
+	return BitsPerSecond(from, v) / BitsPerSecond(to, 1)
+}
+
+// convertUnit converts a librespeed rate (Mbps, or Mibps with MebiBytes) into Unit
+func convertUnit(c clientTypes.Client, mbps float64) float64 {
+	if c.Config.Bytes {
+		return mbps / 8
+	}
+	return mbps
+}
+
 func RoundTo(num float64, precision int) float64 {
 	pow := math.Pow(10, float64(precision))
 	return math.Round(num*pow) / pow
@@ -0,0 +1,64 @@
+package speedtest
+
+import (
+	"testing"
+	"time"
+
+	clientTypes "github.com/inonius/v3cli/api/client"
+)
+
+func TestRoundTo(t *testing.T) {
+	tests := []struct {
+		num       float64
+		precision int
+		want      float64
+	}{
+		{136.01999999999998, 2, 136.02},
+		{0.125, 2, 0.13},
+		{7, 2, 7},
+		{-1.234, 1, -1.2},
+		{1234.5678, 0, 1235},
+		{0.0004, 3, 0},
+	}
+	for _, tt := range tests {
+		if got := RoundTo(tt.num, tt.precision); got != tt.want {
+			t.Errorf("RoundTo(%v, %d) = %v, want %v", tt.num, tt.precision, got, tt.want)
+		}
+	}
+}
+
+func TestThroughput(t *testing.T) {
+	tests := []struct {
+		name             string
+		bytes, mebibytes bool
+		transferred      uint64
+		elapsed          time.Duration
+		want             float64
+	}{
+		{"Mbps", false, false, 125000, time.Second, 1},
+		{"over two seconds", false, false, 12500000, 2 * time.Second, 50},
+		{"MB/s", true, false, 125000, time.Second, 0.125},
+		{"Mibps", false, true, 131072, time.Second, 1},
+		{"MiB/s", true, true, 131072 * 8, time.Second, 1},
+		{"no elapsed time", false, false, 125000, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := clientTypes.Client{Config: &clientTypes.Config{Bytes: tt.bytes, MebiBytes: tt.mebibytes}}
+			if got := throughput(c, tt.transferred, tt.elapsed); got != tt.want {
+				t.Errorf("throughput() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertUnit(t *testing.T) {
+	bits := clientTypes.Client{Config: &clientTypes.Config{}}
+	bytes := clientTypes.Client{Config: &clientTypes.Config{Bytes: true}}
+	if got := convertUnit(bits, 80); got != 80 {
+		t.Errorf("convertUnit() = %v, want 80", got)
+	}
+	if got := convertUnit(bytes, 80); got != 10 {
+		t.Errorf("convertUnit() with Bytes = %v, want 10", got)
+	}
+}
@@ -0,0 +1,169 @@
+package speedtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	clientTypes "github.com/inonius/v3cli/api/client"
+	"github.com/librespeed/speedtest-cli/defs"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	QUICStatusOK      = "ok"
+	QUICStatusBlocked = "blocked"
+	QUICStatusError   = "error"
+
+	// QUIC below this fraction of the TCP throughput is reported as throttled,
+	// QUIC runs in user space and is normally somewhat slower than TCP even when not throttled
+	quicThrottleRatio = 0.2
+)
+
+// QUICProbe handshakes with a QUIC oneshot server, then fetches its endpoint for QUICDuration
+// over HTTP/3 and over TCP, so that a blocked or throttled UDP/443 can be told apart
+func QUICProbe(ctx context.Context, c clientTypes.Client, endpoint string, isIPv4 bool) *clientTypes.QUICResult {
+	r := &clientTypes.QUICResult{Endpoint: endpoint, Family: "IPv6", Status: QUICStatusOK}
+	udp, tcp := "udp6", "tcp6"
+	if isIPv4 {
+		r.Family, udp, tcp = "IPv4", "udp4", "tcp4"
+	}
+	fail := func(status string, err error) *clientTypes.QUICResult {
+		r.Status = status
+		r.Error = err.Error()
+		return r
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fail(QUICStatusError, err)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+	addr, err := net.ResolveUDPAddr(udp, net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return fail(QUICStatusError, err)
+	}
+
+	conn, err := listenUDP(c, udp)
+	if err != nil {
+		return fail(QUICStatusError, err)
+	}
+	defer conn.Close()
+	tr := &quic.Transport{Conn: conn}
+	defer tr.Close()
+
+	tlsConf, err := tlsConfig(c)
+	if err != nil {
+		return fail(QUICStatusError, err)
+	}
+	tlsConf.ServerName = u.Hostname()
+	tlsConf.NextProtos = []string{http3.NextProtoH3}
+
+	start := time.Now()
+	qconn, err := tr.Dial(ctx, addr, tlsConf, &quic.Config{HandshakeIdleTimeout: time.Duration(c.Config.Timeout) * time.Second})
+	if err != nil {
+		var idleErr *quic.IdleTimeoutError
+		var handshakeErr *quic.HandshakeTimeoutError
+		if errors.As(err, &idleErr) || errors.As(err, &handshakeErr) || errors.Is(err, context.DeadlineExceeded) {
+			return fail(QUICStatusBlocked, err)
+		}
+		return fail(QUICStatusError, err)
+	}
+	defer qconn.CloseWithError(0, "")
+	r.Handshake = RoundTo(float64(time.Since(start).Microseconds())/1000, 2)
+	r.Protocol = qconn.ConnectionState().TLS.NegotiatedProtocol
+	r.HTTP3 = r.Protocol == http3.NextProtoH3
+	if !r.HTTP3 {
+		return fail(QUICStatusError, fmt.Errorf("server negotiated %q instead of h3", r.Protocol))
+	}
+
+	bytes, elapsed, err := fetchFor(ctx, (&http3.Transport{}).NewClientConn(qconn), endpoint, c.Config.QUICDuration)
+	if err != nil {
+		return fail(QUICStatusError, err)
+	}
+	r.Throughput = RoundTo(throughput(c, bytes, elapsed), 2)
+
+	// the same endpoint over TCP as the reference
+	transport := c.HttpClient.Transport.(*http.Transport).Clone()
+	if transport.TLSClientConfig, err = tlsConfig(c); err != nil {
+		return fail(QUICStatusError, err)
+	}
+	dial := transport.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	transport.DialContext = func(ctx context.Context, _, address string) (net.Conn, error) {
+		return dial(ctx, tcp, address)
+	}
+	defer transport.CloseIdleConnections()
+
+	bytes, elapsed, err = fetchFor(ctx, transport, endpoint, c.Config.QUICDuration)
+	if err != nil {
+		log.Debugf("TCP reference of %s failed: %s", endpoint, err)
+		return r
+	}
+	r.TCPThroughput = RoundTo(throughput(c, bytes, elapsed), 2)
+	r.Throttled = r.Throughput < r.TCPThroughput*quicThrottleRatio
+	return r
+}
+
+// listenUDP opens the local socket of the probe, bound like the TCP dialer to --source or --interface
+func listenUDP(c clientTypes.Client, network string) (net.PacketConn, error) {
+	var lc net.ListenConfig
+	if c.Config.Interface != "" {
+		dialer, err := NewDialerInterfaceBound(c.Config.Interface)
+		if err != nil {
+			return nil, err
+		}
+		lc.Control = dialer.Control
+	}
+	laddr := ":0"
+	if c.Config.Source != "" {
+		laddr = net.JoinHostPort(c.Config.Source, "0")
+	}
+	return lc.ListenPacket(context.Background(), network, laddr)
+}
+
+// fetchFor requests u through rt until d elapses and counts the body bytes
+func fetchFor(ctx context.Context, rt http.RoundTripper, u string, d time.Duration) (uint64, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	counter := &byteCounter{}
+	start := time.Now()
+	for ctx.Err() == nil {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return 0, 0, err
+		}
+		req.Header.Set("User-Agent", defs.UserAgent)
+
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return 0, 0, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return 0, 0, fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		_, err = io.Copy(counter, resp.Body)
+		resp.Body.Close()
+		if err != nil && ctx.Err() == nil {
+			return 0, 0, err
+		}
+	}
+	return counter.total.Load(), time.Since(start), nil
+}
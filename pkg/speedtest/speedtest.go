@@ -4,10 +4,14 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"path"
+	"slices"
 	"sync"
+	"time"
 
 	clientTypes "github.com/inonius/v3cli/api/client"
 	"github.com/librespeed/speedtest-cli/defs"
@@ -21,11 +25,19 @@ type PingJob struct {
 
 type PingResult struct {
 	Index int
+	Up    bool
 	Ping  float64
 }
 
+// ServerStatus is the reachability of a server as seen by pingWorker
+type ServerStatus struct {
+	Server defs.Server
+	Up     bool
+	Ping   float64
+}
+
 // SpeedTest is the actual main function that handles the speed test(s)
-func Speedtest(c clientTypes.Client, ctx context.Context, logger *slog.Logger, servers []defs.Server) (*clientTypes.SpeedtestResult, error) {
+func Speedtest(c clientTypes.Client, ctx context.Context, logger *slog.Logger, servers []defs.Server) ([]*clientTypes.SpeedtestResult, error) {
 	// check for suppressed output flags
 	var silent bool = true
 	/*
@@ -41,54 +53,175 @@ func Speedtest(c clientTypes.Client, ctx context.Context, logger *slog.Logger, s
 		}
 	*/
 	noICMP := c.Config.NoICMP
-
-	// HTTP requests timeout
-	//c.HttpClient.Timeout = time.Duration(c.Config.Timeout) * time.Second
 	var network string
 
+	transport, err := setupTransport(c)
+	if err != nil {
+		return nil, err
+	}
+
+	servers = excludeServers(servers, c.Config.ExcludeServer)
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no server left after --exclude-server")
+	}
+
+	// if --server or --server-name is given, do speed tests with all of them
+	if pinned := pinnedServers(servers, c.Config.Server, c.Config.ServerName); len(pinned) > 0 {
+		var results []*clientTypes.SpeedtestResult
+		for _, server := range pinned {
+			logger.Info("Testing against pinned server", "ID", server.ID, "Name", server.Name)
+			response, err := doSpeedTest(c, &ctx, logger, []defs.Server{server}, transport, network, silent, noICMP)
+			if err != nil {
+				logger.Error("Speedtest failed", "Name", server.Name, "error", err)
+				continue
+			}
+			if response != nil {
+				results = append(results, response)
+			}
+		}
+		if len(results) == 0 {
+			return nil, fmt.Errorf("speedtest failed on every pinned server")
+		}
+		return results, nil
+	}
+
+	// else select the fastest server from the list
+	logger.Debug("Selecting the fastest server based on ping")
+
+	pingList := make(map[int]float64)
+	for idx, result := range pingServers(c, servers, network) {
+		if result.Up {
+			pingList[idx] = result.Ping
+		}
+	}
+
+	if len(pingList) == 0 {
+		return nil, fmt.Errorf("no server is currently available")
+	}
+
+	// get the fastest server's index in the `servers` array
+	serverIdx := -1
+	for idx, ping := range pingList {
+		if serverIdx < 0 || ping < pingList[serverIdx] {
+			serverIdx = idx
+		}
+	}
+
+	// do speed test on the server
+	response, err := doSpeedTest(c, &ctx, logger, []defs.Server{servers[serverIdx]}, transport, network, silent, noICMP)
+	if err != nil {
+		return nil, err
+	}
+	if response == nil {
+		return nil, fmt.Errorf("server %s is not responding", servers[serverIdx].Name)
+	}
+	return []*clientTypes.SpeedtestResult{response}, nil
+}
+
+// excludeServers drops the servers given by --exclude-server
+func excludeServers(servers []defs.Server, ids []int) []defs.Server {
+	if len(ids) == 0 {
+		return servers
+	}
+	var filtered []defs.Server
+	for _, server := range servers {
+		if !slices.Contains(ids, server.ID) {
+			filtered = append(filtered, server)
+		}
+	}
+	return filtered
+}
+
+// pinnedServers returns the servers matching --server ids or --server-name glob patterns.
+// Server IDs are unique across address families, so only the family owning the id is pinned.
+func pinnedServers(servers []defs.Server, ids []int, names []string) []defs.Server {
+	var pinned []defs.Server
+	for _, server := range servers {
+		if slices.Contains(ids, server.ID) {
+			pinned = append(pinned, server)
+			continue
+		}
+		for _, pattern := range names {
+			if ok, _ := path.Match(pattern, server.Name); ok {
+				pinned = append(pinned, server)
+				break
+			}
+		}
+	}
+	return pinned
+}
+
+// UnmatchedPins returns the --server ids and --server-name patterns matching none of the servers
+func UnmatchedPins(servers []defs.Server, ids []int, names []string) ([]int, []string) {
+	var unmatchedIDs []int
+	for _, id := range ids {
+		if len(pinnedServers(servers, []int{id}, nil)) == 0 {
+			unmatchedIDs = append(unmatchedIDs, id)
+		}
+	}
+	var unmatchedNames []string
+	for _, pattern := range names {
+		if len(pinnedServers(servers, nil, []string{pattern})) == 0 {
+			unmatchedNames = append(unmatchedNames, pattern)
+		}
+	}
+	return unmatchedIDs, unmatchedNames
+}
+
+// setupTransport makes the librespeed http.DefaultClient use the client's transport,
+// the returned transport is also used by the native engine.
+// The transport is process-wide, the daemon serializes measurements with exporter.exclusive.
+func setupTransport(c clientTypes.Client) (*http.Transport, error) {
 	transport := c.HttpClient.Transport.(*http.Transport).Clone()
 	//transport := http.DefaultTransport.(*http.Transport).Clone()
 
+	// HTTP requests timeout, the body is streamed for Duration so only the response header is bounded
+	if c.Config.Timeout > 0 {
+		transport.ResponseHeaderTimeout = time.Duration(c.Config.Timeout) * time.Second
+	}
+
+	tlsConf, err := tlsConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConf
+
+	http.DefaultClient.Transport = transport
+	return transport, nil
+}
+
+// tlsConfig applies --ignore-tls-error and --ca-cert
+func tlsConfig(c clientTypes.Client) (*tls.Config, error) {
 	if caCertFileName := c.Config.CACert; caCertFileName != "" {
 		caCert, err := os.ReadFile(caCertFileName)
 		if err != nil {
-			log.Fatal(err)
+			return nil, fmt.Errorf("failed to read the CA certificate: %w", err)
 		}
 		caCertPool := x509.NewCertPool()
 		caCertPool.AppendCertsFromPEM(caCert)
 
-		transport.TLSClientConfig = &tls.Config{
+		return &tls.Config{
 			InsecureSkipVerify: c.Config.IgnoreTLSError,
 			RootCAs:            caCertPool,
-		}
-	} else {
-		transport.TLSClientConfig = &tls.Config{
-			InsecureSkipVerify: c.Config.IgnoreTLSError,
-		}
+		}, nil
 	}
+	return &tls.Config{
+		InsecureSkipVerify: c.Config.IgnoreTLSError,
+	}, nil
+}
 
-	http.DefaultClient.Transport = transport
-
-	/*
-		// if --server is given, do speed tests with all of them
-		if len(c.Config.Server) > 0 {
-			_, err := doSpeedTest(c, &ctx, logger, servers, telemetryServer, network, silent, noICMP)
-			return nil, err
-		} else {
-	*/
-	// else select the fastest server from the list
-	logger.Debug("Selecting the fastest server based on ping")
-
+// pingServers checks every server concurrently, the result is keyed by the index in `servers`
+func pingServers(c clientTypes.Client, servers []defs.Server, network string) map[int]PingResult {
 	var wg sync.WaitGroup
 	jobs := make(chan PingJob, len(servers))
 	results := make(chan PingResult, len(servers))
 	done := make(chan struct{})
 
-	pingList := make(map[int]float64)
+	pingList := make(map[int]PingResult)
 
 	// spawn 10 concurrent pingers
 	for i := 0; i < 10; i++ {
-		go pingWorker(jobs, results, &wg, c.Config.Source, network, noICMP)
+		go pingWorker(jobs, results, &wg, c.Config.Source, network, c.Config.NoICMP)
 	}
 
 	// send ping jobs to workers
@@ -96,6 +229,7 @@ func Speedtest(c clientTypes.Client, ctx context.Context, logger *slog.Logger, s
 		wg.Add(1)
 		jobs <- PingJob{Index: idx, Server: server}
 	}
+	close(jobs)
 
 	go func() {
 		wg.Wait()
@@ -106,40 +240,47 @@ Loop:
 	for {
 		select {
 		case result := <-results:
-			pingList[result.Index] = result.Ping
+			pingList[result.Index] = result
 		case <-done:
 			break Loop
 		}
 	}
+	// drain results sent right before done was closed
+	for len(results) > 0 {
+		result := <-results
+		pingList[result.Index] = result
+	}
+	return pingList
+}
 
-	if len(pingList) == 0 {
-		log.Fatal("No server is currently available, please try again later.")
+// ProbeServers reports whether each server is up and its RTT, for the servers command
+func ProbeServers(c clientTypes.Client, servers []defs.Server) ([]ServerStatus, error) {
+	if _, err := setupTransport(c); err != nil {
+		return nil, err
 	}
 
-	// get the fastest server's index in the `servers` array
-	var serverIdx int
-	for idx, ping := range pingList {
-		if ping > 0 && ping <= pingList[serverIdx] {
-			serverIdx = idx
+	pingList := pingServers(c, servers, "")
+	statuses := make([]ServerStatus, len(servers))
+	for idx, server := range servers {
+		statuses[idx] = ServerStatus{Server: server}
+		if result, ok := pingList[idx]; ok {
+			statuses[idx].Up = result.Up
+			statuses[idx].Ping = result.Ping
 		}
 	}
-
-	// do speed test on the server
-	response, err := doSpeedTest(c, &ctx, logger, []defs.Server{servers[serverIdx]}, network, silent, noICMP)
-	return response, err
-	//}
+	return statuses, nil
 }
 
 func pingWorker(jobs <-chan PingJob, results chan<- PingResult, wg *sync.WaitGroup, srcIp, network string, noICMP bool) {
-	for {
-		job := <-jobs
+	for job := range jobs {
 		server := job.Server
 		// get the URL of the speed test server from the JSON
 		u, err := server.GetURL()
 		if err != nil {
 			log.Debugf("Server URL is invalid for %s (%s), skipping", server.Name, server.Server)
+			results <- PingResult{Index: job.Index}
 			wg.Done()
-			return
+			continue
 		}
 
 		// check the server is up by accessing the ping URL and checking its returned value == empty and status code == 200
@@ -151,14 +292,16 @@ func pingWorker(jobs <-chan PingJob, results chan<- PingResult, wg *sync.WaitGro
 			ping, _, err := server.ICMPPingAndJitter(1, srcIp, network)
 			if err != nil {
 				log.Debugf("Can't ping server %s (%s), skipping", server.Name, u.Hostname())
+				results <- PingResult{Index: job.Index}
 				wg.Done()
-				return
+				continue
 			}
 			// return result
-			results <- PingResult{Index: job.Index, Ping: ping}
+			results <- PingResult{Index: job.Index, Up: true, Ping: ping}
 			wg.Done()
 		} else {
 			log.Debugf("Server %s (%s) doesn't seem to be up, skipping", server.Name, u.Hostname())
+			results <- PingResult{Index: job.Index}
 			wg.Done()
 		}
 	}
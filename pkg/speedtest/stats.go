@@ -0,0 +1,70 @@
+package speedtest
+
+import (
+	"math"
+	"slices"
+
+	clientTypes "github.com/inonius/v3cli/api/client"
+)
+
+// Percentile returns the p-th (0-100) percentile of values with linear interpolation
+func Percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return sorted[lower]
+	}
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// Mean returns the arithmetic mean of values
+func Mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var total float64
+	for _, v := range values {
+		total += v
+	}
+	return total / float64(len(values))
+}
+
+// Stability is 1 minus the coefficient of variation, clamped to 0-1.
+// 1 is a perfectly flat throughput, a sawtooth pattern goes towards 0.
+func Stability(values []float64) float64 {
+	mean := Mean(values)
+	if mean <= 0 {
+		return 0
+	}
+	var variance float64
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	cv := math.Sqrt(variance/float64(len(values))) / mean
+	return math.Max(0, math.Min(1, 1-cv))
+}
+
+// throughputStats summarises the total rate of the samples
+func throughputStats(samples []clientTypes.ThroughputSample) *clientTypes.ThroughputStats {
+	if len(samples) == 0 {
+		return nil
+	}
+	rates := make([]float64, len(samples))
+	for i, sample := range samples {
+		rates[i] = sample.Rate
+	}
+	return &clientTypes.ThroughputStats{
+		Peak:      RoundTo(slices.Max(rates), 2),
+		Median:    RoundTo(Percentile(rates, 50), 2),
+		P10:       RoundTo(Percentile(rates, 10), 2),
+		P90:       RoundTo(Percentile(rates, 90), 2),
+		Stability: RoundTo(Stability(rates), 3),
+	}
+}
@@ -0,0 +1,100 @@
+package speedtest
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	clientTypes "github.com/inonius/v3cli/api/client"
+)
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		p      float64
+		want   float64
+	}{
+		{"empty", nil, 50, 0},
+		{"single value", []float64{5}, 90, 5},
+		{"median of an even count", []float64{1, 2, 3, 4}, 50, 2.5},
+		{"median of an odd count", []float64{1, 2, 3}, 50, 2},
+		{"minimum", []float64{1, 2, 3, 4}, 0, 1},
+		{"maximum", []float64{1, 2, 3, 4}, 100, 4},
+		{"p10 interpolated", []float64{10, 20, 30, 40, 50}, 10, 14},
+		{"p90 interpolated", []float64{10, 20, 30, 40, 50}, 90, 46},
+		{"unsorted", []float64{30, 10, 20}, 50, 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Percentile(tt.values, tt.p); !almostEqual(got, tt.want) {
+				t.Errorf("Percentile(%v, %v) = %v, want %v", tt.values, tt.p, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPercentileKeepsOrder(t *testing.T) {
+	values := []float64{3, 1, 2}
+	Percentile(values, 50)
+	if !reflect.DeepEqual(values, []float64{3, 1, 2}) {
+		t.Errorf("Percentile sorted its input: %v", values)
+	}
+}
+
+func TestMean(t *testing.T) {
+	tests := []struct {
+		values []float64
+		want   float64
+	}{
+		{nil, 0},
+		{[]float64{4}, 4},
+		{[]float64{1, 2, 3, 4}, 2.5},
+	}
+	for _, tt := range tests {
+		if got := Mean(tt.values); !almostEqual(got, tt.want) {
+			t.Errorf("Mean(%v) = %v, want %v", tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestStability(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   float64
+	}{
+		{"empty", nil, 0},
+		{"no throughput", []float64{0, 0}, 0},
+		{"flat", []float64{5, 5, 5}, 1},
+		{"coefficient of variation 0.2", []float64{8, 12}, 0.8},
+		{"coefficient of variation 1", []float64{0, 10}, 0},
+		{"clamped to 0", []float64{0, 0, 30}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Stability(tt.values); !almostEqual(got, tt.want) {
+				t.Errorf("Stability(%v) = %v, want %v", tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThroughputStats(t *testing.T) {
+	if got := throughputStats(nil); got != nil {
+		t.Errorf("throughputStats(nil) = %+v, want nil", got)
+	}
+
+	var samples []clientTypes.ThroughputSample
+	for i, rate := range []float64{30, 10, 50, 20, 40} {
+		samples = append(samples, clientTypes.ThroughputSample{Time: float64(i + 1), Rate: rate})
+	}
+	want := &clientTypes.ThroughputStats{Peak: 50, Median: 30, P10: 14, P90: 46, Stability: 0.529}
+	if got := throughputStats(samples); !reflect.DeepEqual(got, want) {
+		t.Errorf("throughputStats() = %+v, want %+v", got, want)
+	}
+}